@@ -1,6 +1,7 @@
 package dynago
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -45,6 +46,9 @@ func EncodeValue(value interface{}) AttributeValue {
 	case float32, float64:
 		return AttributeValue{NUMBER_ATTRIBUTE: fmt.Sprintf("%f", v)}
 
+	case json.Number:
+		return AttributeValue{NUMBER_ATTRIBUTE: v.String()}
+
 	/*
 		 // Go doesn't have sets (and JSON doesn't have set neither,
 		 // so we can't distinguish between an array and a set
@@ -111,7 +115,17 @@ func DecodeValue(attrValue AttributeValue) interface{} {
 			}
 
 		case NUMBER_SET_ATTRIBUTE:
-			ss := v.([]string)
+			var ss []string
+			switch v := v.(type) {
+			case []string:
+				ss = v
+			case []interface{}: // from JSON
+				ss = make([]string, len(v))
+				for i, n := range v {
+					ss[i], _ = n.(string)
+				}
+			}
+
 			ff := make([]float32, len(ss))
 			for i, n := range ss {
 				f, _ := strconv.ParseFloat(n, 32)
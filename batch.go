@@ -0,0 +1,243 @@
+package dynago
+
+import (
+	"time"
+)
+
+const (
+	MAX_BATCH_WRITE = 25  // maximum number of requests in a BatchWriteItem call
+	MAX_BATCH_GET   = 100 // maximum number of keys in a BatchGetItem call
+
+	batchRetryWait    = 50 * time.Millisecond
+	batchMaxRetryWait = 5 * time.Second
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// BatchWriteItem
+//
+
+type PutRequest struct {
+	Item AttributeNameValue
+}
+
+type DeleteRequest struct {
+	Key AttributeNameValue
+}
+
+type WriteRequest struct {
+	PutRequest    *PutRequest    `json:",omitempty"`
+	DeleteRequest *DeleteRequest `json:",omitempty"`
+}
+
+func PutWriteRequest(item AttributeNameValue) WriteRequest {
+	return WriteRequest{PutRequest: &PutRequest{Item: item}}
+}
+
+func DeleteWriteRequest(key AttributeNameValue) WriteRequest {
+	return WriteRequest{DeleteRequest: &DeleteRequest{Key: key}}
+}
+
+type BatchWriteItemRequest struct {
+	RequestItems           map[string][]WriteRequest
+	ReturnConsumedCapacity string `json:",omitempty"`
+}
+
+type BatchWriteItemResult struct {
+	UnprocessedItems map[string][]WriteRequest
+	ConsumedCapacity []ConsumedCapacityDescription
+}
+
+//
+// BwReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE),
+// overriding the consumed flag of BatchWriteItem
+//
+func BwReturnConsumed(target string) BatchWriteOption {
+	return func(opts *batchWriteOptions) {
+		opts.returnConsumed = target
+	}
+}
+
+//
+// BatchWriteItem executes up to MAX_BATCH_WRITE put/delete requests (on one or more tables)
+// and returns the requests that were not processed and the capacity consumed on each table
+//
+func (db *DBClient) BatchWriteItem(requests map[string][]WriteRequest, consumed bool, options ...BatchWriteOption) (map[string][]WriteRequest, []ConsumedCapacityDescription, error) {
+	for _, reqs := range requests {
+		if err := checkBatchSizes(reqs, options); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var req = BatchWriteItemRequest{RequestItems: requests, ReturnConsumedCapacity: RETURN_CONSUMED[consumed]}
+	var res BatchWriteItemResult
+
+	var opts batchWriteOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if len(opts.returnConsumed) > 0 {
+		req.ReturnConsumedCapacity = opts.returnConsumed
+	}
+
+	if err := db.Query("BatchWriteItem", &req).Decode(&res); err != nil {
+		return nil, nil, err
+	}
+
+	return res.UnprocessedItems, res.ConsumedCapacity, nil
+}
+
+//
+// BatchWriteAll writes all the requests to the table, in batches of MAX_BATCH_WRITE,
+// retrying the unprocessed requests with exponential backoff. It returns the consumed capacity.
+// With BwMaxItemSize all the requests are checked before writing the first batch.
+//
+func (db *DBClient) BatchWriteAll(tableName string, requests []WriteRequest, options ...BatchWriteOption) (ConsumedCapacityDescription, error) {
+	var consumed ConsumedCapacityDescription
+
+	if err := checkBatchSizes(requests, options); err != nil {
+		return consumed, err
+	}
+
+	for len(requests) > 0 {
+		n := len(requests)
+		if n > MAX_BATCH_WRITE {
+			n = MAX_BATCH_WRITE
+		}
+
+		batch := map[string][]WriteRequest{tableName: requests[:n]}
+		requests = requests[n:]
+
+		wait := batchRetryWait
+
+		for len(batch) > 0 {
+			unprocessed, units, err := db.BatchWriteItem(batch, true, options...)
+			if err != nil {
+				return consumed, err
+			}
+
+			for _, c := range units {
+				consumed.Add(c)
+			}
+
+			if len(unprocessed[tableName]) == 0 {
+				break
+			}
+
+			batch = unprocessed
+
+			time.Sleep(wait)
+			if wait *= 2; wait > batchMaxRetryWait {
+				wait = batchMaxRetryWait
+			}
+		}
+	}
+
+	return consumed, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// BatchGetItem
+//
+
+type KeysAndAttributes struct {
+	Keys                     []AttributeNameValue
+	ConsistentRead           bool              `json:",omitempty"`
+	ProjectionExpression     string            `json:",omitempty"`
+	ExpressionAttributeNames map[string]string `json:",omitempty"`
+}
+
+type BatchGetItemRequest struct {
+	RequestItems           map[string]KeysAndAttributes
+	ReturnConsumedCapacity string `json:",omitempty"`
+}
+
+type BatchGetItemResult struct {
+	Responses        map[string][]Item
+	UnprocessedKeys  map[string]KeysAndAttributes
+	ConsumedCapacity []ConsumedCapacityDescription
+}
+
+//
+// BatchGetOption configures BatchGetItem and BatchGetAll
+//
+type BatchGetOption func(*BatchGetItemRequest)
+
+//
+// BgReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE),
+// overriding the consumed flag of BatchGetItem
+//
+func BgReturnConsumed(target string) BatchGetOption {
+	return func(req *BatchGetItemRequest) {
+		req.ReturnConsumedCapacity = target
+	}
+}
+
+//
+// BatchGetItem reads up to MAX_BATCH_GET items (from one or more tables)
+// and returns the items found, the keys that were not processed and the capacity consumed on each table
+//
+func (db *DBClient) BatchGetItem(requests map[string]KeysAndAttributes, consumed bool, options ...BatchGetOption) (map[string][]Item, map[string]KeysAndAttributes, []ConsumedCapacityDescription, error) {
+	var req = BatchGetItemRequest{RequestItems: requests, ReturnConsumedCapacity: RETURN_CONSUMED[consumed]}
+	var res BatchGetItemResult
+
+	for _, option := range options {
+		option(&req)
+	}
+
+	if err := db.Query("BatchGetItem", &req).Decode(&res); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return res.Responses, res.UnprocessedKeys, res.ConsumedCapacity, nil
+}
+
+//
+// BatchGetAll reads all the items with the specified keys from the table, in batches of MAX_BATCH_GET,
+// retrying the unprocessed keys with exponential backoff. It returns the items found (in no particular order)
+// and the consumed capacity.
+//
+func (db *DBClient) BatchGetAll(tableName string, keys []AttributeNameValue, consistent bool, options ...BatchGetOption) ([]Item, ConsumedCapacityDescription, error) {
+	var items []Item
+	var consumed ConsumedCapacityDescription
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > MAX_BATCH_GET {
+			n = MAX_BATCH_GET
+		}
+
+		batch := map[string]KeysAndAttributes{tableName: KeysAndAttributes{Keys: keys[:n], ConsistentRead: consistent}}
+		keys = keys[n:]
+
+		wait := batchRetryWait
+
+		for len(batch) > 0 {
+			responses, unprocessed, units, err := db.BatchGetItem(batch, true, options...)
+			if err != nil {
+				return items, consumed, err
+			}
+
+			for _, c := range units {
+				consumed.Add(c)
+			}
+
+			items = append(items, responses[tableName]...)
+
+			if len(unprocessed[tableName].Keys) == 0 {
+				break
+			}
+
+			batch = unprocessed
+
+			time.Sleep(wait)
+			if wait *= 2; wait > batchMaxRetryWait {
+				wait = batchMaxRetryWait
+			}
+		}
+	}
+
+	return items, consumed, nil
+}
@@ -0,0 +1,378 @@
+package dynago
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Read-through cache
+//
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+type cacheEntry struct {
+	key     string
+	table   string // for query results, the table queried
+	value   interface{}
+	expires time.Time
+}
+
+type cachedQuery struct {
+	items []Item
+	last  AttributeNameValue
+}
+
+//
+// ItemCache is an LRU cache (with TTL) for the results of TableInstance.GetItem and Query,
+// enabled with TableInstance.SetCache.
+//
+// Only full items are cached (GetItem with a list of attributes bypasses the cache) and consistent reads
+// always go to the table (but refresh the cache).
+//
+// A cache can be shared by multiple tables. Writes made through the same TableInstance (PutItem, UpdateItem, DeleteItem)
+// invalidate the cached item and all the cached query results for the table. Writes made by other clients can be tracked by following the table stream
+// with the handler returned by TableInstance.CacheInvalidator; otherwise they are only visible after the entries expire.
+//
+type ItemCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	queries map[string]map[*list.Element]bool // query results by table
+	stats   CacheStats
+}
+
+//
+// NewItemCache creates a cache with up to maxEntries entries (0 for no limit),
+// each one valid for ttl (0 for no expiration)
+//
+func NewItemCache(maxEntries int, ttl time.Duration) *ItemCache {
+	return &ItemCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+		queries:    map[string]map[*list.Element]bool{},
+	}
+}
+
+func (c *ItemCache) get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			return entry.value, true
+		}
+
+		c.remove(el)
+	}
+
+	c.stats.Misses++
+	return nil, false
+}
+
+//
+// set adds an item (queryTable is empty) or a query result for queryTable to the cache
+//
+func (c *ItemCache) set(key string, queryTable string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	el := c.lru.PushFront(&cacheEntry{key: key, table: queryTable, value: value, expires: expires})
+	c.entries[key] = el
+
+	if len(queryTable) > 0 {
+		if c.queries[queryTable] == nil {
+			c.queries[queryTable] = map[*list.Element]bool{}
+		}
+
+		c.queries[queryTable][el] = true
+	}
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *ItemCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+
+	if len(entry.table) > 0 {
+		delete(c.queries[entry.table], el)
+	}
+}
+
+//
+// invalidate removes the item with the specified key and all the query results for the table
+//
+func (c *ItemCache) invalidate(table, key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	for el := range c.queries[table] {
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).key)
+	}
+
+	delete(c.queries, table)
+}
+
+//
+// Clear removes all the entries from the cache
+//
+func (c *ItemCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.queries = map[string]map[*list.Element]bool{}
+}
+
+//
+// Stats returns the cache statistics
+//
+func (c *ItemCache) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+//
+// SetCache enables caching of GetItem and Query results for this table (a nil cache disables it).
+// See ItemCache.
+//
+func (table *TableInstance) SetCache(cache *ItemCache) *TableInstance {
+	table.cache = cache
+	return table
+}
+
+func (table *TableInstance) Cache() *ItemCache {
+	return table.cache
+}
+
+//
+// CacheInvalidator returns a stream record handler that removes the modified items from the cache
+// (to be used with StreamReader.Read or Follow)
+//
+func (table *TableInstance) CacheInvalidator() RecordHandler {
+	return func(shardId string, record Record) error {
+		if table.cache == nil {
+			return nil
+		}
+
+		keys := record.Dynamodb.Keys
+
+		var rangeKey interface{}
+		if table.HashRange() {
+			rangeKey = keys[table.RangeKey().AttributeName]
+		}
+
+		table.cache.invalidate(table.Name, table.itemCacheKey(keys[table.HashKey().AttributeName], rangeKey))
+		return nil
+	}
+}
+
+//
+// cacheKeyValue returns the key value as a string. Numbers are normalized, so that the same key
+// passed as int, float or json.Number (or decoded from a stream record) maps to the same entry.
+//
+func cacheKeyValue(attr *AttributeDefinition, value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+
+	for _, v := range encodeKeyValue(*attr, value) {
+		s := fmt.Sprint(v)
+
+		if attr.AttributeType == NUMBER_ATTRIBUTE {
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return strconv.FormatFloat(n, 'g', -1, 64)
+			}
+		}
+
+		return s
+	}
+
+	return ""
+}
+
+func (table *TableInstance) itemCacheKey(hashKey, rangeKey interface{}) string {
+	key := "i\x00" + table.Name + "\x00" + cacheKeyValue(table.HashKey(), hashKey)
+	if table.HashRange() {
+		key += "\x00" + cacheKeyValue(table.RangeKey(), rangeKey)
+	}
+
+	return key
+}
+
+func queryCacheKey(req *QueryRequest) (string, bool) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+
+	return "q\x00" + req.TableName + "\x00" + string(data), true
+}
+
+func (table *TableInstance) invalidateItem(hashKey, rangeKey interface{}) {
+	if table.cache != nil {
+		table.cache.invalidate(table.Name, table.itemCacheKey(hashKey, rangeKey))
+	}
+}
+
+//
+// copyItem returns a deep copy of the item, so that changes to maps and lists in the items
+// returned to the caller don't modify the cached items
+//
+func copyItem(item map[string]interface{}) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+
+	c := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		c[k] = copyValue(v)
+	}
+
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return copyItem(v)
+
+	case Item:
+		return Item(copyItem(v))
+
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyValue(e)
+		}
+		return c
+
+	case []string:
+		return append([]string(nil), v...)
+
+	case []byte:
+		return append([]byte(nil), v...)
+
+	case [][]byte:
+		c := make([][]byte, len(v))
+		for i, b := range v {
+			c[i] = append([]byte(nil), b...)
+		}
+		return c
+
+	case []float32:
+		return append([]float32(nil), v...)
+	}
+
+	return v
+}
+
+func (table *TableInstance) cachedGetItem(hashKey interface{}, rangeKey interface{}, consistent bool, consumed bool, options ...GetItemOption) (map[string]interface{}, ConsumedCapacityDescription, error) {
+	key := table.itemCacheKey(hashKey, rangeKey)
+
+	if !consistent {
+		if item, ok := table.cache.get(key); ok {
+			return copyItem(item.(map[string]interface{})), ConsumedCapacityDescription{}, nil
+		}
+	}
+
+	hkey := &KeyValue{*table.HashKey(), hashKey}
+
+	var rkey *KeyValue
+	if table.HashRange() {
+		rkey = &KeyValue{*table.RangeKey(), rangeKey}
+	}
+
+	item, units, err := table.DB.GetItem(table.Name, hkey, rkey, nil, consistent, consumed, options...)
+	if err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	table.cache.set(key, "", copyItem(item))
+	return item, units, nil
+}
+
+func (req *QueryRequest) cachedExec(db *DBClient, cache *ItemCache) ([]Item, AttributeNameValue, ConsumedCapacityDescription, error) {
+	key, ok := queryCacheKey(req)
+	if ok && !req.ConsistentRead {
+		if res, ok := cache.get(key); ok {
+			q := res.(*cachedQuery)
+
+			items := make([]Item, len(q.items))
+			for i, item := range q.items {
+				items[i] = copyItem(item)
+			}
+
+			return items, q.last, ConsumedCapacityDescription{}, nil
+		}
+	}
+
+	var res QueryResult
+
+	if err := db.Query("Query", req).Decode(&res); err != nil {
+		return nil, nil, ConsumedCapacityDescription{}, err
+	}
+
+	if ok {
+		items := make([]Item, len(res.Items))
+		for i, item := range res.Items {
+			items[i] = copyItem(item)
+		}
+
+		cache.set(key, req.TableName, &cachedQuery{items: items, last: res.LastEvaluatedKey})
+	}
+
+	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity, nil
+}
+
+func (table *TableInstance) isCacheable(attributes []string) bool {
+	return table.cache != nil && len(attributes) == 0
+}
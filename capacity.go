@@ -0,0 +1,340 @@
+package dynago
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+const (
+	READ_UNIT_SIZE  = 4 * 1024 // bytes read for one read capacity unit (strongly consistent)
+	WRITE_UNIT_SIZE = 1024     // bytes written for one write capacity unit
+
+	indexItemOverhead = 100 // bytes added to the size of each index entry
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Capacity estimation
+//
+
+//
+// CapacityEstimate is the estimated capacity consumed by an operation
+//
+type CapacityEstimate struct {
+	ReadUnits  float64
+	WriteUnits float64
+	Table      float64            // units consumed by the table
+	Indexes    map[string]float64 // units consumed by each index
+}
+
+func (e *CapacityEstimate) Total() float64 {
+	return e.ReadUnits + e.WriteUnits
+}
+
+func (e *CapacityEstimate) add(o CapacityEstimate) {
+	e.ReadUnits += o.ReadUnits
+	e.WriteUnits += o.WriteUnits
+	e.Table += o.Table
+
+	for name, units := range o.Indexes {
+		if e.Indexes == nil {
+			e.Indexes = map[string]float64{}
+		}
+
+		e.Indexes[name] += units
+	}
+}
+
+func (e *CapacityEstimate) scale(factor float64) {
+	e.ReadUnits *= factor
+	e.WriteUnits *= factor
+	e.Table *= factor
+
+	for name := range e.Indexes {
+		e.Indexes[name] *= factor
+	}
+}
+
+//
+// ReadUnits returns the read capacity units needed to read size bytes
+// (1 unit every 4KB for consistent reads, half for eventually consistent reads)
+//
+func ReadUnits(size int, consistent bool) float64 {
+	units := math.Ceil(float64(size) / READ_UNIT_SIZE)
+	if units < 1 {
+		units = 1
+	}
+
+	if !consistent {
+		units /= 2
+	}
+
+	return units
+}
+
+//
+// WriteUnits returns the write capacity units needed to write size bytes (1 unit every 1KB)
+//
+func WriteUnits(size int) float64 {
+	units := math.Ceil(float64(size) / WRITE_UNIT_SIZE)
+	if units < 1 {
+		units = 1
+	}
+
+	return units
+}
+
+//
+// EstimateGetItem returns the capacity consumed by a GetItem that returns item
+//
+func EstimateGetItem(item Item, consistent bool) CapacityEstimate {
+	units := ReadUnits(ItemSize(item), consistent)
+	return CapacityEstimate{ReadUnits: units, Table: units}
+}
+
+//
+// indexEntry returns the attributes of item stored in the index (nil if the item doesn't have the index keys)
+//
+func (desc *TableDescription) indexEntry(index *IndexDefinition, item Item) Item {
+	if item == nil {
+		return nil
+	}
+
+	entry := Item{}
+
+	for _, k := range index.keyNames() {
+		v, ok := item[k]
+		if !ok || v == nil {
+			return nil // sparse index
+		}
+
+		entry[k] = v
+	}
+
+	for _, k := range desc.KeySchema {
+		entry[k.AttributeName] = item[k.AttributeName]
+	}
+
+	switch index.Projection.ProjectionType {
+	case PROJECTION_ALL:
+		for k, v := range item {
+			entry[k] = v
+		}
+
+	case PROJECTION_INCLUDE:
+		for _, k := range index.Projection.NonKeyAttributes {
+			if v, ok := item[k]; ok {
+				entry[k] = v
+			}
+		}
+	}
+
+	return entry
+}
+
+//
+// estimateWrite returns the capacity consumed to replace the old item (nil if new) with the new item (nil if deleted)
+//
+func (desc *TableDescription) estimateWrite(old, new Item) CapacityEstimate {
+	size := ItemSize(old)
+	if s := ItemSize(new); s > size {
+		size = s
+	}
+
+	units := WriteUnits(size)
+	estimate := CapacityEstimate{WriteUnits: units, Table: units}
+
+	for _, index := range desc.indexDefinitions() {
+		oldEntry := desc.indexEntry(index, old)
+		newEntry := desc.indexEntry(index, new)
+
+		var units float64
+
+		switch {
+		case oldEntry == nil && newEntry == nil:
+			continue
+
+		case oldEntry == nil:
+			units = WriteUnits(ItemSize(newEntry) + indexItemOverhead)
+
+		case newEntry == nil:
+			units = WriteUnits(ItemSize(oldEntry) + indexItemOverhead)
+
+		case reflect.DeepEqual(oldEntry, newEntry):
+			continue
+
+		case !sameKeys(index.keyNames(), oldEntry, newEntry):
+			// the old entry is deleted and the new one is added
+			units = WriteUnits(ItemSize(oldEntry)+indexItemOverhead) + WriteUnits(ItemSize(newEntry)+indexItemOverhead)
+
+		default:
+			size := ItemSize(oldEntry)
+			if s := ItemSize(newEntry); s > size {
+				size = s
+			}
+
+			units = WriteUnits(size + indexItemOverhead)
+		}
+
+		if estimate.Indexes == nil {
+			estimate.Indexes = map[string]float64{}
+		}
+
+		estimate.Indexes[index.Name] = units
+		estimate.WriteUnits += units
+	}
+
+	return estimate
+}
+
+func sameKeys(keys []string, a, b Item) bool {
+	for _, k := range keys {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//
+// EstimatePutItem returns the capacity consumed by writing item, replacing old (nil if the item is new),
+// including the writes to the secondary indexes
+//
+func (desc *TableDescription) EstimatePutItem(item, old Item) CapacityEstimate {
+	return desc.estimateWrite(old, item)
+}
+
+//
+// EstimateUpdateItem returns the capacity consumed by an update that changes old (nil if the item is new) into new,
+// including the writes to the secondary indexes
+//
+func (desc *TableDescription) EstimateUpdateItem(old, new Item) CapacityEstimate {
+	return desc.estimateWrite(old, new)
+}
+
+//
+// EstimateDeleteItem returns the capacity consumed by deleting old, including the writes to the secondary indexes
+//
+func (desc *TableDescription) EstimateDeleteItem(old Item) CapacityEstimate {
+	return desc.estimateWrite(old, nil)
+}
+
+//
+// EstimateTransactGet returns the capacity consumed by a transaction reading the items
+// (transactional reads cost twice as much as consistent reads)
+//
+func EstimateTransactGet(items ...Item) CapacityEstimate {
+	var estimate CapacityEstimate
+
+	for _, item := range items {
+		estimate.add(EstimateGetItem(item, true))
+	}
+
+	estimate.scale(2)
+	return estimate
+}
+
+//
+// EstimateTransactWrite returns the capacity consumed by a transaction including the write operations
+// (estimated with EstimatePutItem, EstimateUpdateItem or EstimateDeleteItem).
+// Transactional writes cost twice as much as standard writes.
+//
+func EstimateTransactWrite(writes ...CapacityEstimate) CapacityEstimate {
+	var estimate CapacityEstimate
+
+	for _, w := range writes {
+		estimate.add(w)
+	}
+
+	estimate.scale(2)
+	return estimate
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Estimated vs actual capacity
+//
+
+//
+// CapacityReport compares the estimated and the actual consumed capacity of a request
+//
+type CapacityReport struct {
+	Action    string
+	Table     string
+	Estimated CapacityEstimate
+	Actual    float64
+}
+
+//
+// EstimateCapacity returns a middleware that calls report with the estimated and actual capacity
+// of each request that returns the consumed capacity. Index writes are estimated for the tables
+// with a description.
+//
+// The estimates need the item sizes, so they are only available for GetItem, PutItem (as an insert,
+// unless ReturnValues is ALL_OLD), UpdateItem with ReturnValues ALL_NEW (as an insert)
+// and DeleteItem with ReturnValues ALL_OLD.
+//
+func EstimateCapacity(report func(CapacityReport), tables ...*TableDescription) Middleware {
+	descriptions := map[string]*TableDescription{}
+	for _, desc := range tables {
+		descriptions[desc.TableName] = desc
+	}
+
+	return Observe(func(action string, input, output interface{}, err error, elapsed time.Duration) {
+		if err != nil {
+			return
+		}
+
+		var estimate CapacityEstimate
+		var actual ConsumedCapacityDescription
+		var table string
+
+		switch action {
+		case "GetItem":
+			req, ok := input.(GetItemRequest)
+			res, rok := output.(*GetItemResult)
+			if !ok || !rok || len(req.ReturnConsumedCapacity) == 0 || req.ReturnConsumedCapacity == RETURN_NONE {
+				return
+			}
+
+			table, actual = req.TableName, res.ConsumedCapacity
+			estimate = EstimateGetItem(res.Item, req.ConsistentRead)
+
+		case "PutItem", "UpdateItem", "DeleteItem":
+			req, ok := input.(*ItemRequest)
+			res, rok := output.(*ItemResult)
+			if !ok || !rok || len(req.ReturnConsumedCapacity) == 0 || req.ReturnConsumedCapacity == RETURN_NONE {
+				return
+			}
+
+			table, actual = req.TableName, res.ConsumedCapacity
+			desc := descriptions[table]
+
+			switch {
+			case action == "PutItem" && req.Item != nil:
+				var old Item
+				if req.ReturnValues == RETURN_ALL_OLD {
+					old = res.Attributes
+				}
+
+				estimate = desc.EstimatePutItem(*req.Item, old)
+
+			case action == "UpdateItem" && req.ReturnValues == RETURN_ALL_NEW:
+				estimate = desc.EstimateUpdateItem(nil, res.Attributes)
+
+			case action == "DeleteItem" && req.ReturnValues == RETURN_ALL_OLD:
+				estimate = desc.EstimateDeleteItem(res.Attributes)
+
+			default:
+				return
+			}
+
+		default:
+			return
+		}
+
+		report(CapacityReport{Action: action, Table: table, Estimated: estimate, Actual: float64(actual.CapacityUnits)})
+	})
+}
@@ -0,0 +1,82 @@
+package dynago
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testCapacityTable() *TableDescription {
+	return &TableDescription{
+		TableName: "test",
+		KeySchema: []KeySchemaElement{{AttributeName: "id", KeyType: HASH_KEY_TYPE}},
+		AttributeDefinitions: []AttributeDefinition{
+			{AttributeName: "id", AttributeType: STRING_ATTRIBUTE},
+			{AttributeName: "email", AttributeType: STRING_ATTRIBUTE},
+		},
+		GlobalSecondaryIndexes: []GlobalSecondaryIndexDescription{
+			{
+				IndexName:  "byEmail",
+				KeySchema:  []KeySchemaElement{{AttributeName: "email", KeyType: HASH_KEY_TYPE}},
+				Projection: ProjectionDescription{ProjectionType: PROJECTION_ALL},
+			},
+		},
+	}
+}
+
+func TestEstimateSetsAndBinary(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"binary", bytes.Repeat([]byte("x"), 3000)},
+		{"string set", []string{strings.Repeat("a", 1500), strings.Repeat("b", 1500)}},
+		{"binary set", [][]byte{bytes.Repeat([]byte("a"), 1500), bytes.Repeat([]byte("b"), 1500)}},
+		{"number set", func() []float32 {
+			ns := make([]float32, 600)
+			for i := range ns {
+				ns[i] = float32(1000001 + 2*i) // 7 digits: 5 bytes each
+			}
+			return ns
+		}()},
+		{"nested binary", map[string]interface{}{"b": bytes.Repeat([]byte("x"), 3000)}},
+	}
+
+	desc := testCapacityTable()
+
+	for _, test := range tests {
+		item := Item{"id": "1", "email": "a@b", "data": test.value}
+
+		// more than 2KB and less than 3KB: 3 write units for the table and 4 for the index (with the overhead)
+		put := desc.EstimatePutItem(item, nil)
+		if put.Table != 3 || put.Indexes["byEmail"] != 4 || put.WriteUnits != 7 {
+			t.Errorf("%v: put estimate %+v", test.name, put)
+		}
+
+		if get := EstimateGetItem(item, true); get.ReadUnits != 1 {
+			t.Errorf("%v: get estimate %+v", test.name, get)
+		}
+
+		del := desc.EstimateDeleteItem(item)
+		if del.Table != 3 || del.Indexes["byEmail"] != 4 {
+			t.Errorf("%v: delete estimate %+v", test.name, del)
+		}
+	}
+}
+
+func TestEstimateLargeSet(t *testing.T) {
+	set := make([]string, 10)
+	for i := range set {
+		set[i] = strings.Repeat(string(rune('a'+i)), 1000)
+	}
+
+	item := Item{"id": "1", "data": set}
+
+	if get := EstimateGetItem(item, true); get.ReadUnits != 3 {
+		t.Errorf("get estimate %+v", get)
+	}
+
+	if put := testCapacityTable().EstimatePutItem(item, nil); put.WriteUnits != 10 || len(put.Indexes) != 0 {
+		t.Errorf("put estimate %+v", put)
+	}
+}
@@ -0,0 +1,267 @@
+package dynago
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+//
+// EventType is the type of change described by a stream record
+//
+type EventType int
+
+const (
+	EVENT_UNKNOWN EventType = iota
+	EVENT_INSERT
+	EVENT_MODIFY
+	EVENT_REMOVE
+)
+
+var eventNames = map[EventType]string{
+	EVENT_UNKNOWN: "UNKNOWN",
+	EVENT_INSERT:  "INSERT",
+	EVENT_MODIFY:  "MODIFY",
+	EVENT_REMOVE:  "REMOVE",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+//
+// ParseEventType converts a stream record EventName to an EventType
+//
+func ParseEventType(name string) EventType {
+	for t, n := range eventNames {
+		if n == name {
+			return t
+		}
+	}
+
+	return EVENT_UNKNOWN
+}
+
+//
+// ItemDiff lists the attribute paths that differ between two items.
+//
+// Paths use the document path syntax: nested map attributes are separated by "." and
+// list elements are indicated by "[index]" (i.e. "address.lines[1]").
+// Sets are compared as unordered collections and reported as a single changed path.
+//
+type ItemDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+//
+// Empty returns true if there are no differences
+//
+func (diff *ItemDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+//
+// DiffItems compares two items and returns the attribute paths added, removed or changed in newItem.
+//
+// Decoded items don't preserve string sets (they are decoded as lists), so string sets are compared by position:
+// use DiffAttributes when the typed values are available.
+//
+func DiffItems(oldItem, newItem Item) *ItemDiff {
+	diff := &ItemDiff{}
+	diff.compareMaps("", oldItem, newItem)
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+//
+// DiffAttributes compares two items with DynamoDB typed values (as in a stream record)
+// and returns the attribute paths added, removed or changed in newItem
+//
+func DiffAttributes(oldItem, newItem AttributeNameValue) *ItemDiff {
+	return DiffItems(typedItem(oldItem), typedItem(newItem))
+}
+
+func (diff *ItemDiff) compareMaps(prefix string, oldMap, newMap map[string]interface{}) {
+	for k, ov := range oldMap {
+		path := k
+		if len(prefix) > 0 {
+			path = prefix + "." + k
+		}
+
+		if nv, ok := newMap[k]; ok {
+			diff.compareValues(path, ov, nv)
+		} else {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			path := k
+			if len(prefix) > 0 {
+				path = prefix + "." + k
+			}
+
+			diff.Added = append(diff.Added, path)
+		}
+	}
+}
+
+func (diff *ItemDiff) compareLists(prefix string, oldList, newList []interface{}) {
+	for i, ov := range oldList {
+		path := fmt.Sprintf("%v[%d]", prefix, i)
+
+		if i < len(newList) {
+			diff.compareValues(path, ov, newList[i])
+		} else {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+
+	for i := len(oldList); i < len(newList); i++ {
+		diff.Added = append(diff.Added, fmt.Sprintf("%v[%d]", prefix, i))
+	}
+}
+
+func (diff *ItemDiff) compareValues(path string, oldValue, newValue interface{}) {
+	switch ov := oldValue.(type) {
+	case map[string]interface{}:
+		if nv, ok := newValue.(map[string]interface{}); ok {
+			diff.compareMaps(path, ov, nv)
+			return
+		}
+
+	case []interface{}:
+		if nv, ok := newValue.([]interface{}); ok {
+			diff.compareLists(path, ov, nv)
+			return
+		}
+
+	case stringSet, numberSet, binarySet, []float32:
+		if !reflect.DeepEqual(setMembers(oldValue), setMembers(newValue)) {
+			diff.Changed = append(diff.Changed, path)
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		diff.Changed = append(diff.Changed, path)
+	}
+}
+
+//
+// setMembers returns the sorted members of a set (nil if the value is not a set).
+// Numbers are normalized, so that "1" and "1.0" are the same member.
+//
+func setMembers(v interface{}) []string {
+	var members []string
+
+	switch v := v.(type) {
+	case stringSet:
+		members = append(members, v...)
+
+	case numberSet:
+		for _, n := range v {
+			f, _ := n.Float64()
+			members = append(members, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+
+	case []float32: // decoded number set
+		for _, n := range v {
+			members = append(members, strconv.FormatFloat(float64(n), 'g', -1, 32))
+		}
+
+	case binarySet:
+		for _, b := range v {
+			members = append(members, string(b))
+		}
+
+	default:
+		return nil
+	}
+
+	sort.Strings(members)
+	return members
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// ChangeEvent
+//
+
+//
+// ChangeEvent is a typed view of a stream record
+//
+type ChangeEvent struct {
+	Type           EventType
+	EventID        string
+	SequenceNumber string
+
+	Keys     Item
+	OldImage Item
+	NewImage Item
+
+	// Diff is nil if it cannot be computed from the available images
+	// (i.e. MODIFY events for streams that are not NEW_AND_OLD_IMAGES)
+	Diff *ItemDiff
+}
+
+//
+// NewChangeEvent creates a ChangeEvent from a stream record, computing the difference
+// between the old and new images
+//
+func NewChangeEvent(record Record) *ChangeEvent {
+	values := record.Dynamodb
+
+	event := &ChangeEvent{
+		Type:           ParseEventType(record.EventName),
+		EventID:        record.EventID,
+		SequenceNumber: values.SequenceNumber,
+		Keys:           values.Keys,
+		OldImage:       values.OldImage,
+		NewImage:       values.NewImage,
+	}
+
+	// use the typed images when available, so that sets are compared as sets
+	oldImage, newImage := values.OldImage, values.NewImage
+	if values.oldImage != nil || values.newImage != nil {
+		oldImage, newImage = typedItem(values.oldImage), typedItem(values.newImage)
+	}
+
+	switch event.Type {
+	case EVENT_INSERT:
+		if values.StreamViewType == STREAM_VIEW_NEW || values.StreamViewType == STREAM_VIEW_ALL {
+			event.Diff = DiffItems(nil, newImage)
+		}
+
+	case EVENT_REMOVE:
+		if values.StreamViewType == STREAM_VIEW_OLD || values.StreamViewType == STREAM_VIEW_ALL {
+			event.Diff = DiffItems(oldImage, nil)
+		}
+
+	case EVENT_MODIFY:
+		if values.StreamViewType == STREAM_VIEW_ALL {
+			event.Diff = DiffItems(oldImage, newImage)
+		}
+	}
+
+	return event
+}
+
+//
+// ChangeEvent returns a typed view of the record
+//
+func (record *Record) ChangeEvent() *ChangeEvent {
+	return NewChangeEvent(*record)
+}
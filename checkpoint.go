@@ -0,0 +1,184 @@
+package dynago
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	CHECKPOINT_SEQUENCE = "SequenceNumber"
+)
+
+//
+// CheckpointStore records the last processed sequence number for each shard of a stream,
+// so that a stream consumer can resume from where it stopped
+//
+type CheckpointStore interface {
+	// GetCheckpoint returns the last processed sequence number for the shard, or "" if none
+	GetCheckpoint(streamArn, shardId string) (string, error)
+
+	// SetCheckpoint records the last processed sequence number for the shard
+	SetCheckpoint(streamArn, shardId, sequenceNumber string) error
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// FileCheckpointStore
+//
+
+//
+// FileCheckpointStore stores the checkpoints in a local JSON file
+//
+type FileCheckpointStore struct {
+	path        string
+	lock        sync.Mutex
+	checkpoints map[string]map[string]string // streamArn -> shardId -> sequenceNumber
+}
+
+//
+// NewFileCheckpointStore creates a checkpoint store backed by the specified file,
+// loading the existing checkpoints if the file exists
+//
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	store := &FileCheckpointStore{path: path, checkpoints: map[string]map[string]string{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.checkpoints); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (store *FileCheckpointStore) GetCheckpoint(streamArn, shardId string) (string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.checkpoints[streamArn][shardId], nil
+}
+
+func (store *FileCheckpointStore) SetCheckpoint(streamArn, shardId, sequenceNumber string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	shards := store.checkpoints[streamArn]
+	if shards == nil {
+		shards = map[string]string{}
+		store.checkpoints[streamArn] = shards
+	}
+
+	shards[shardId] = sequenceNumber
+	return store.save()
+}
+
+//
+// save writes the checkpoints to a temporary file and renames it,
+// so that the checkpoint file is never left half written
+//
+func (store *FileCheckpointStore) save() error {
+	data, err := json.MarshalIndent(store.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), store.path)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// TableCheckpointStore
+//
+
+//
+// TableCheckpointStore stores the checkpoints in a DynamoDB table.
+//
+// If the table has hash and range keys the stream ARN is stored in the hash key and the shard id
+// in the range key, otherwise the hash key is "streamArn/shardId". Both keys should be strings.
+// CreateCheckpointTable creates a table with StreamId (the stream ARN) and ShardId as keys.
+//
+type TableCheckpointStore struct {
+	table *TableInstance
+}
+
+func NewTableCheckpointStore(table *TableInstance) *TableCheckpointStore {
+	return &TableCheckpointStore{table: table}
+}
+
+//
+// CreateCheckpointTable creates a table suitable for TableCheckpointStore
+//
+func (db *DBClient) CreateCheckpointTable(tableName string, rc, wc int) (*TableInstance, error) {
+	attributes := []AttributeDefinition{
+		AttributeDefinition{"StreamId", STRING_ATTRIBUTE},
+		AttributeDefinition{"ShardId", STRING_ATTRIBUTE},
+	}
+
+	return db.CreateTableInstance(tableName, attributes, []string{"StreamId", "ShardId"}, rc, wc, STREAM_VIEW_DISABLED)
+}
+
+func (store *TableCheckpointStore) keys(streamArn, shardId string) (interface{}, interface{}) {
+	if store.table.HashRange() {
+		return streamArn, shardId
+	}
+
+	return streamArn + "/" + shardId, nil
+}
+
+func (store *TableCheckpointStore) GetCheckpoint(streamArn, shardId string) (string, error) {
+	hashKey, rangeKey := store.keys(streamArn, shardId)
+
+	item, _, err := store.table.GetItem(hashKey, rangeKey, nil, true, false)
+	if err != nil {
+		return "", err
+	}
+
+	if seq, ok := item[CHECKPOINT_SEQUENCE].(string); ok {
+		return seq, nil
+	}
+
+	return "", nil
+}
+
+func (store *TableCheckpointStore) SetCheckpoint(streamArn, shardId, sequenceNumber string) error {
+	hashKey, rangeKey := store.keys(streamArn, shardId)
+
+	item := Item{
+		store.table.HashKey().AttributeName: hashKey,
+		CHECKPOINT_SEQUENCE:                 sequenceNumber,
+	}
+
+	if rangeKey != nil {
+		item[store.table.RangeKey().AttributeName] = rangeKey
+	}
+
+	_, _, err := store.table.PutItem(item)
+	return err
+}
@@ -0,0 +1,283 @@
+package dynago
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_COPY_CREATE_TIMEOUT = 10 * time.Minute
+)
+
+// returned by the segments stopped because another segment failed
+var errCopyCanceled = errors.New("copy canceled")
+
+//
+// CopyProgress reports the status of a table copy
+//
+type CopyProgress struct {
+	Items         int64 // items written to the destination table
+	Skipped       int64 // items skipped by the transform function
+	ReadConsumed  float32
+	WriteConsumed float32
+}
+
+//
+// CopyTransform is called for every item copied and returns the item to write
+// (or nil to skip the item).
+//
+// The item is passed as DynamoDB typed values, since decoding it to an Item is lossy
+// (i.e. sets become lists and numbers lose precision). Use EncodeAttributeValue or EncodeValue
+// to set new values.
+//
+type CopyTransform func(item AttributeNameValue) (AttributeNameValue, error)
+
+type copyRequest struct {
+	transform CopyTransform
+	create    bool
+	segments  int
+	pageSize  int
+	readRate  float64
+	writeRate float64
+	progress  func(CopyProgress)
+}
+
+type CopyOption func(*copyRequest)
+
+func CpTransform(transform CopyTransform) CopyOption {
+	return func(req *copyRequest) {
+		req.transform = transform
+	}
+}
+
+//
+// CpCreateTable creates the destination table (with the same schema of the source table) before copying
+//
+func CpCreateTable(create bool) CopyOption {
+	return func(req *copyRequest) {
+		req.create = create
+	}
+}
+
+//
+// CpSegments sets the number of source segments scanned in parallel
+//
+func CpSegments(segments int) CopyOption {
+	return func(req *copyRequest) {
+		req.segments = segments
+	}
+}
+
+func CpPageSize(size int) CopyOption {
+	return func(req *copyRequest) {
+		req.pageSize = size
+	}
+}
+
+//
+// CpRateLimit sets the maximum read capacity units (on the source) and write capacity units
+// (on the destination) consumed per second
+//
+func CpRateLimit(readUnits, writeUnits float64) CopyOption {
+	return func(req *copyRequest) {
+		req.readRate = readUnits
+		req.writeRate = writeUnits
+	}
+}
+
+//
+// CpProgress sets a function called after every page is copied
+// (concurrently, when copying multiple segments)
+//
+func CpProgress(progress func(CopyProgress)) CopyOption {
+	return func(req *copyRequest) {
+		req.progress = progress
+	}
+}
+
+//
+// CopyTable copies all the items of srcTable (using the src client) to dstTable (using the dst client).
+// The clients can be configured with different endpoints/credentials.
+//
+// The items are copied (and passed to the transform function) as DynamoDB typed values, without decoding them.
+// Items that have the same key in the destination table (i.e. when the transform changes the keys)
+// are written in separate batches, and the last one copied wins.
+//
+// If a segment fails the other segments are stopped and the first error is returned.
+//
+func CopyTable(src *DBClient, srcTable string, dst *DBClient, dstTable string, options ...CopyOption) (*CopyProgress, error) {
+	req := copyRequest{segments: 1}
+
+	for _, option := range options {
+		option(&req)
+	}
+
+	if req.segments < 1 {
+		req.segments = 1
+	}
+
+	if req.create {
+		desc, err := src.DescribeTable(srcTable)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := dst.CreateTableFromDescription(dstTable, desc); err != nil {
+			return nil, err
+		}
+
+		if _, err := dst.WaitForTable(dstTable, TABLE_STATUS_ACTIVE, DEFAULT_COPY_CREATE_TIMEOUT); err != nil {
+			return nil, err
+		}
+	}
+
+	table, err := dst.GetTable(dstTable)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &CopyProgress{}
+	readLimiter := newRateLimiter(req.readRate)
+	writeLimiter := newRateLimiter(req.writeRate)
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	// fail records the first error, failed returns true if any segment failed
+	fail := func(serr error) {
+		lock.Lock()
+		if err == nil {
+			err = serr
+		}
+		lock.Unlock()
+	}
+
+	failed := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return err != nil
+	}
+
+	for segment := 0; segment < req.segments; segment++ {
+		wg.Add(1)
+
+		go func(segment int) {
+			defer wg.Done()
+
+			scan := Scan(srcTable).SetConsumed(true)
+			if req.segments > 1 {
+				scan.SetSegment(segment, req.segments)
+			}
+			if req.pageSize > 0 {
+				scan.SetLimit(req.pageSize)
+			}
+
+			serr := scan.each(src, readLimiter, func(items []AttributeNameValue, consumed float32) error {
+				if failed() {
+					return errCopyCanceled
+				}
+
+				requests := make([]WriteRequest, 0, len(items))
+				skipped := 0
+
+				for _, item := range items {
+					if req.transform != nil {
+						transformed, err := req.transform(item)
+						if err != nil {
+							return err
+						}
+
+						if transformed == nil {
+							skipped++
+							continue
+						}
+
+						item = transformed
+					}
+
+					requests = append(requests, PutWriteRequest(item))
+				}
+
+				written, count, werr := table.writeUnique(requests, failed)
+
+				lock.Lock()
+				progress.ReadConsumed += consumed
+				progress.WriteConsumed += written.CapacityUnits
+				progress.Skipped += int64(skipped)
+				progress.Items += int64(count)
+				current := *progress
+				lock.Unlock()
+
+				if werr != nil {
+					return werr
+				}
+
+				if req.progress != nil {
+					req.progress(current)
+				}
+
+				writeLimiter.wait(float64(written.CapacityUnits))
+				return nil
+			})
+
+			if serr != nil && serr != errCopyCanceled {
+				fail(serr)
+			}
+		}(segment)
+	}
+
+	wg.Wait()
+	return progress, err
+}
+
+//
+// writeUnique writes the requests with BatchWriteAll, flushing the pending requests when a key is repeated
+// (a batch can't contain the same key twice) and stopping when canceled returns true.
+// It returns the consumed capacity and the number of requests written.
+//
+func (table *TableInstance) writeUnique(requests []WriteRequest, canceled func() bool) (ConsumedCapacityDescription, int, error) {
+	var consumed ConsumedCapacityDescription
+
+	written := 0
+	keys := map[string]bool{}
+	start := 0
+
+	flush := func(end int) error {
+		if canceled() {
+			return errCopyCanceled
+		}
+
+		units, err := table.DB.BatchWriteAll(table.Name, requests[start:end])
+		consumed.Add(units)
+		if err != nil {
+			return err
+		}
+
+		written += end - start
+		start = end
+		keys = map[string]bool{}
+		return nil
+	}
+
+	for i, req := range requests {
+		if key, ok := table.importKey(req.PutRequest.Item); ok {
+			if keys[key] {
+				if err := flush(i); err != nil {
+					return consumed, written, err
+				}
+			}
+
+			keys[key] = true
+		}
+	}
+
+	if start < len(requests) {
+		if err := flush(len(requests)); err != nil {
+			return consumed, written, err
+		}
+	}
+
+	return consumed, written, nil
+}
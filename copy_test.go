@@ -0,0 +1,111 @@
+package dynago
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//
+// testScanClient returns a client with a middleware that answers Scan requests with scan(segment, page)
+//
+func testScanClient(scan func(segment, page int) ([]AttributeNameValue, bool, error)) *DBClient {
+	db := NewDBClient()
+	db.SetRegionAndURL("local", "http://localhost:8000")
+	db.Use(func(next QueryFunc) QueryFunc {
+		return func(action string, input, output interface{}) error {
+			if action != "Scan" {
+				return errors.New("unexpected action " + action)
+			}
+
+			req := input.(*ScanRequest)
+
+			segment, page := 0, 0
+			if req.Segment != nil {
+				segment = *req.Segment
+			}
+			if req.ExclusiveStartKey != nil {
+				page, _ = strconv.Atoi(req.ExclusiveStartKey["page"][NUMBER_ATTRIBUTE].(string))
+			}
+
+			items, more, err := scan(segment, page)
+			if err != nil {
+				return err
+			}
+
+			res := output.(*RawQueryResult)
+			res.Items = items
+			if more {
+				res.LastEvaluatedKey = AttributeNameValue{"page": {NUMBER_ATTRIBUTE: strconv.Itoa(page + 1)}}
+			}
+
+			return nil
+		}
+	})
+
+	return db
+}
+
+func TestCopyDuplicateKeys(t *testing.T) {
+	src := testScanClient(func(segment, page int) ([]AttributeNameValue, bool, error) {
+		return []AttributeNameValue{
+			{"id": {STRING_ATTRIBUTE: "a"}, "group": {STRING_ATTRIBUTE: "x"}, "v": {NUMBER_ATTRIBUTE: "1"}},
+			{"id": {STRING_ATTRIBUTE: "b"}, "group": {STRING_ATTRIBUTE: "x"}, "v": {NUMBER_ATTRIBUTE: "2"}},
+			{"id": {STRING_ATTRIBUTE: "c"}, "group": {STRING_ATTRIBUTE: "y"}, "v": {NUMBER_ATTRIBUTE: "3"}},
+		}, false, nil
+	})
+
+	items := map[string]AttributeNameValue{}
+	dst := testBatchTable(items, 0)
+
+	// the destination table is keyed by group
+	regroup := func(item AttributeNameValue) (AttributeNameValue, error) {
+		return AttributeNameValue{"id": item["group"], "v": item["v"]}, nil
+	}
+
+	progress, err := CopyTable(src, "src", dst.DB, "test", CpTransform(regroup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Items != 3 || len(items) != 2 {
+		t.Fatalf("items written: %v, stored: %v", progress.Items, len(items))
+	}
+
+	if v := items["x"]["v"][NUMBER_ATTRIBUTE]; v != "2" {
+		t.Errorf("x: got v=%v, want 2", v)
+	}
+}
+
+func TestCopySegmentFailure(t *testing.T) {
+	scanErr := errors.New("scan failed")
+
+	src := testScanClient(func(segment, page int) ([]AttributeNameValue, bool, error) {
+		if segment == 0 {
+			return nil, false, scanErr
+		}
+
+		// the other segments never end
+		time.Sleep(time.Millisecond)
+		return []AttributeNameValue{{"id": {STRING_ATTRIBUTE: strconv.Itoa(page)}}}, true, nil
+	})
+
+	dst := testBatchTable(map[string]AttributeNameValue{}, 0)
+	done := make(chan error)
+
+	go func() {
+		_, err := CopyTable(src, "src", dst.DB, "test", CpSegments(3))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != scanErr {
+			t.Fatalf("got %v, want %v", err, scanErr)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("segments not canceled")
+	}
+}
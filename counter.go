@@ -0,0 +1,158 @@
+package dynago
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Atomic counters
+//
+
+//
+// Increment atomically adds delta (that can be negative) to the numeric attribute attr
+// of the item with the specified key and returns the new value.
+// If the item or the attribute don't exist they are created (starting from 0).
+//
+func (table *TableInstance) Increment(hashKey interface{}, rangeKey interface{}, attr string, delta int64) (int64, ConsumedCapacityDescription, error) {
+	res, consumed, err := table.UpdateItem(hashKey, rangeKey, "ADD #counter :delta",
+		ExpressionAttributeNames(map[string]string{"#counter": attr}),
+		ExpressionAttributeValues(map[string]interface{}{":delta": delta}),
+		ReturnValues(RETURN_UPDATED_NEW))
+
+	if err != nil {
+		return 0, consumed, err
+	}
+
+	n, ok := toNumber((*res)[attr])
+	if !ok {
+		return 0, consumed, fmt.Errorf("invalid counter value %v", (*res)[attr])
+	}
+
+	return int64(n), consumed, nil
+}
+
+//
+// ShardedCounter is a counter that spreads the writes over multiple items (shards),
+// to avoid hot partitions, and aggregates the shards on read.
+//
+// On a table with hash and range key all shards have the counter name as hash key
+// and the shard number as range key (and are read with Query).
+// On a table with only a (string) hash key the shards are stored as "name#shard"
+// (and are read with BatchGetItem).
+//
+type ShardedCounter struct {
+	table  *TableInstance
+	name   string
+	attr   string
+	shards int
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+//
+// NewShardedCounter creates a counter with the specified name and number of shards,
+// where the value of each shard is stored in the attribute attr
+//
+func (table *TableInstance) NewShardedCounter(name, attr string, shards int) *ShardedCounter {
+	if shards < 1 {
+		shards = 1
+	}
+
+	return &ShardedCounter{
+		table:  table,
+		name:   name,
+		attr:   attr,
+		shards: shards,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (c *ShardedCounter) shardKey(shard int) (interface{}, interface{}) {
+	if !c.table.HashRange() {
+		return fmt.Sprintf("%v#%v", c.name, shard), nil
+	}
+
+	if c.table.RangeKey().AttributeType == NUMBER_ATTRIBUTE {
+		return c.name, shard
+	}
+
+	return c.name, strconv.Itoa(shard)
+}
+
+//
+// Add adds delta to a random shard and returns the new value of the shard
+//
+func (c *ShardedCounter) Add(delta int64) (int64, ConsumedCapacityDescription, error) {
+	c.lock.Lock()
+	shard := c.rand.Intn(c.shards)
+	c.lock.Unlock()
+
+	hkey, rkey := c.shardKey(shard)
+	return c.table.Increment(hkey, rkey, c.attr, delta)
+}
+
+//
+// Value returns the current value of the counter (the sum of all the shards)
+//
+func (c *ShardedCounter) Value(consistent bool) (int64, ConsumedCapacityDescription, error) {
+	var items []Item
+	var consumed ConsumedCapacityDescription
+
+	if c.table.HashRange() {
+		query := QueryTable(c.table).
+			SetConditionExpression("#name = :name").
+			SetProjectionExpression("#counter").
+			SetAttributeNames(map[string]string{"#name": c.table.HashKey().AttributeName, "#counter": c.attr}).
+			SetAttributeValues(map[string]interface{}{":name": c.name}).
+			SetConsistentRead(consistent).
+			SetConsumed(true)
+
+		for {
+			res, last, units, err := query.Exec(nil)
+			consumed.Add(units)
+			if err != nil {
+				return 0, consumed, err
+			}
+
+			items = append(items, res...)
+
+			if last == nil {
+				break
+			}
+
+			query = query.SetStartKey(last)
+		}
+	} else {
+		hkey := *c.table.HashKey()
+
+		keys := make([]AttributeNameValue, c.shards)
+		for i := range keys {
+			h, _ := c.shardKey(i)
+			keys[i] = EncodeAttribute(hkey, h)
+		}
+
+		res, units, err := c.table.DB.BatchGetAll(c.table.Name, keys, consistent)
+		consumed.Add(units)
+		if err != nil {
+			return 0, consumed, err
+		}
+
+		items = res
+	}
+
+	var total int64
+
+	for _, item := range items {
+		if n, ok := toNumber(item[c.attr]); ok {
+			total += int64(n)
+		}
+	}
+
+	return total, consumed, nil
+}
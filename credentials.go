@@ -0,0 +1,452 @@
+package dynago
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raff/aws4"
+)
+
+const (
+	DEFAULT_PROFILE = "default"
+
+	// credentials are refreshed when they expire within this window
+	CREDENTIALS_REFRESH_WINDOW = 5 * time.Minute
+)
+
+var (
+	ERR_NO_CREDENTIALS = errors.New("no credentials found")
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Credentials providers
+//
+
+//
+// Credentials are AWS credentials, possibly temporary (with a session token and an expiration time)
+//
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expires      time.Time // zero if the credentials don't expire
+	Source       string    // name of the provider
+}
+
+//
+// Expiring returns true if the credentials expire within the specified window
+//
+func (c *Credentials) Expiring(window time.Duration) bool {
+	return !c.Expires.IsZero() && time.Now().Add(window).After(c.Expires)
+}
+
+func (c *Credentials) keys() *aws4.Keys {
+	return &aws4.Keys{AccessKey: c.AccessKey, SecretKey: c.SecretKey, SecurityToken: c.SessionToken}
+}
+
+//
+// CredentialsProvider returns AWS credentials (ERR_NO_CREDENTIALS if the provider has none)
+//
+type CredentialsProvider interface {
+	Retrieve() (*Credentials, error)
+}
+
+//
+// StaticProvider returns fixed credentials
+//
+type StaticProvider struct {
+	Credentials
+}
+
+func (p *StaticProvider) Retrieve() (*Credentials, error) {
+	if len(p.AccessKey) == 0 || len(p.SecretKey) == 0 {
+		return nil, ERR_NO_CREDENTIALS
+	}
+
+	c := p.Credentials
+	c.Source = "static"
+	return &c, nil
+}
+
+//
+// EnvProvider returns the credentials from the environment variables
+// AWS_ACCESS_KEY_ID (or AWS_ACCESS_KEY), AWS_SECRET_ACCESS_KEY (or AWS_SECRET_KEY)
+// and AWS_SESSION_TOKEN (or AWS_SECURITY_TOKEN)
+//
+type EnvProvider struct{}
+
+func getenv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); len(v) > 0 {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (p *EnvProvider) Retrieve() (*Credentials, error) {
+	c := &Credentials{
+		AccessKey:    getenv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretKey:    getenv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken: getenv("AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN"),
+		Source:       "environment",
+	}
+
+	if len(c.AccessKey) == 0 || len(c.SecretKey) == 0 {
+		return nil, ERR_NO_CREDENTIALS
+	}
+
+	return c, nil
+}
+
+//
+// SharedFileProvider returns the credentials for a named profile from the shared credentials file
+// (~/.aws/credentials or AWS_SHARED_CREDENTIALS_FILE) and config file (~/.aws/config or AWS_CONFIG_FILE).
+//
+// The profile can have static keys (aws_access_key_id, aws_secret_access_key, aws_session_token)
+// or a credential_process command.
+//
+type SharedFileProvider struct {
+	Profile         string // default: AWS_PROFILE or "default"
+	CredentialsFile string
+	ConfigFile      string
+}
+
+func awsDir() string {
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" && len(home) == 0 {
+		home = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(home, ".aws")
+}
+
+func (p *SharedFileProvider) profile() string {
+	if len(p.Profile) > 0 {
+		return p.Profile
+	}
+
+	if profile := getenv("AWS_PROFILE", "AWS_DEFAULT_PROFILE"); len(profile) > 0 {
+		return profile
+	}
+
+	return DEFAULT_PROFILE
+}
+
+//
+// settings returns the profile settings, merging the config file and the credentials file
+// (the credentials file has precedence)
+//
+func (p *SharedFileProvider) settings() (map[string]string, error) {
+	credentialsFile := p.CredentialsFile
+	if len(credentialsFile) == 0 {
+		credentialsFile = getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if len(credentialsFile) == 0 {
+		credentialsFile = filepath.Join(awsDir(), "credentials")
+	}
+
+	configFile := p.ConfigFile
+	if len(configFile) == 0 {
+		configFile = getenv("AWS_CONFIG_FILE")
+	}
+	if len(configFile) == 0 {
+		configFile = filepath.Join(awsDir(), "config")
+	}
+
+	profile := p.profile()
+	settings := map[string]string{}
+	found := false
+
+	// in the config file the sections are [profile name], except for the default profile
+	sections := []string{"profile " + profile}
+	if profile == DEFAULT_PROFILE {
+		sections = append(sections, DEFAULT_PROFILE)
+	}
+
+	for _, f := range []struct {
+		name     string
+		sections []string
+	}{
+		{configFile, sections},
+		{credentialsFile, []string{profile}},
+	} {
+		ini, err := readIniFile(f.name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, section := range f.sections {
+			if values, ok := ini[section]; ok {
+				found = true
+
+				for k, v := range values {
+					settings[k] = v
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, ERR_NO_CREDENTIALS
+	}
+
+	return settings, nil
+}
+
+//
+// Region returns the region configured for the profile, if any
+//
+func (p *SharedFileProvider) Region() string {
+	settings, err := p.settings()
+	if err != nil {
+		return ""
+	}
+
+	return settings["region"]
+}
+
+func (p *SharedFileProvider) Retrieve() (*Credentials, error) {
+	settings, err := p.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	if command := settings["credential_process"]; len(command) > 0 && len(settings["aws_access_key_id"]) == 0 {
+		return (&ProcessProvider{Command: command}).Retrieve()
+	}
+
+	c := &Credentials{
+		AccessKey:    settings["aws_access_key_id"],
+		SecretKey:    settings["aws_secret_access_key"],
+		SessionToken: settings["aws_session_token"],
+		Source:       "shared file: " + p.profile(),
+	}
+
+	if len(c.AccessKey) == 0 || len(c.SecretKey) == 0 {
+		return nil, ERR_NO_CREDENTIALS
+	}
+
+	return c, nil
+}
+
+//
+// readIniFile parses an AWS configuration file (sections of key = value, with # and ; comments)
+//
+func readIniFile(name string) (map[string]map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	ini := map[string]map[string]string{}
+	var section map[string]string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+
+		switch {
+		case len(line) == 0 || line[0] == '#' || line[0] == ';':
+			continue
+
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			if section = ini[name]; section == nil {
+				section = map[string]string{}
+				ini[name] = section
+			}
+
+		case raw[0] == ' ' || raw[0] == '\t':
+			continue // nested values (i.e. s3 settings) are not supported
+
+		case section != nil:
+			if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+				section[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	return ini, scanner.Err()
+}
+
+//
+// ProcessProvider runs an external command that returns the credentials as JSON
+// (see the credential_process setting in the AWS CLI documentation)
+//
+type ProcessProvider struct {
+	Command string
+}
+
+type processCredentials struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      *time.Time
+}
+
+func (p *ProcessProvider) Retrieve() (*Credentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", p.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.Command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential_process: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var pc processCredentials
+	if err := json.Unmarshal(out, &pc); err != nil {
+		return nil, fmt.Errorf("credential_process: %v", err)
+	}
+
+	if pc.Version != 1 {
+		return nil, fmt.Errorf("credential_process: unsupported version %v", pc.Version)
+	}
+
+	if len(pc.AccessKeyId) == 0 || len(pc.SecretAccessKey) == 0 {
+		return nil, fmt.Errorf("credential_process: %v", ERR_NO_CREDENTIALS)
+	}
+
+	c := &Credentials{
+		AccessKey:    pc.AccessKeyId,
+		SecretKey:    pc.SecretAccessKey,
+		SessionToken: pc.SessionToken,
+		Source:       "process",
+	}
+
+	if pc.Expiration != nil {
+		c.Expires = *pc.Expiration
+	}
+
+	return c, nil
+}
+
+//
+// ChainProvider returns the credentials from the first provider that has them
+//
+type ChainProvider []CredentialsProvider
+
+func (chain ChainProvider) Retrieve() (*Credentials, error) {
+	for _, p := range chain {
+		c, err := p.Retrieve()
+		if err == ERR_NO_CREDENTIALS {
+			continue
+		}
+
+		return c, err
+	}
+
+	return nil, ERR_NO_CREDENTIALS
+}
+
+//
+// DefaultCredentialsChain looks for credentials in the environment and then in the shared files
+// for the named profile (if empty: AWS_PROFILE or "default")
+//
+func DefaultCredentialsChain(profile string) CredentialsProvider {
+	return ChainProvider{&EnvProvider{}, &SharedFileProvider{Profile: profile}}
+}
+
+//
+// cachingProvider caches the credentials until they are about to expire
+//
+type cachingProvider struct {
+	provider CredentialsProvider
+
+	lock        sync.Mutex
+	credentials *Credentials
+}
+
+//
+// Retrieve returns the cached credentials (the same instance until they are refreshed,
+// so that clients sharing the provider can tell when they changed)
+//
+func (p *cachingProvider) Retrieve() (*Credentials, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.credentials != nil && !p.credentials.Expiring(CREDENTIALS_REFRESH_WINDOW) {
+		return p.credentials, nil
+	}
+
+	c, err := p.provider.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+
+	p.credentials = c
+	return c, nil
+}
+
+//
+// SetCredentialsProvider sets a provider for the client credentials.
+// Temporary credentials are refreshed automatically before they expire.
+//
+func (db *DBClient) SetCredentialsProvider(provider CredentialsProvider) *DBClient {
+	db.credentials = &cachingProvider{provider: provider}
+	return db
+}
+
+//
+// refreshCredentials updates the client keys if the credentials changed since they were last used
+// by this client (the provider can be shared with other clients, i.e. a StreamsClient)
+//
+func (db *DBClient) refreshCredentials() error {
+	c, err := db.credentials.Retrieve()
+	if err != nil {
+		return err
+	}
+
+	db.clientLock.Lock()
+	defer db.clientLock.Unlock()
+
+	if c != db.signing || db.Client == nil {
+		db.signing = c
+
+		client := &aws4.Client{Keys: c.keys()}
+		if db.Client != nil {
+			client.Client = db.Client.Client
+		}
+
+		db.Client = client
+	}
+
+	return nil
+}
+
+//
+// errorDecoder is a dydb.Decoder that only returns an error
+//
+type errorDecoder struct {
+	err error
+}
+
+func (d errorDecoder) Decode(v interface{}) error {
+	return d.err
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/raff/aws4/dydb"
 
 	"strings"
+	"sync"
 )
 
 const (
@@ -15,9 +16,14 @@ const (
 	REGION_US_WEST_2 = "us-west-2"
 
 	RETRY_COUNT = 10
+
+	errorThroughputExceeded   = "ProvisionedThroughputExceededException"
+	errorThrottling           = "ThrottlingException"
+	errorRequestLimitExceeded = "RequestLimitExceeded"
 )
 
 var (
+	// Deprecated: use EndpointResolver, that knows all regions
 	Regions = map[string]string{
 		REGION_US_EAST_1: "https://dynamodb.us-east-1.amazonaws.com/",
 		REGION_US_WEST_1: "https://dynamodb.us-west-1.amazonaws.com/",
@@ -32,6 +38,15 @@ var (
 
 type DBClient struct {
 	dydb.DB
+
+	clientLock sync.RWMutex // guards DB.Client, that is replaced when the credentials are refreshed
+
+	middlewares    []Middleware // see Use
+	retryObservers []RetryObserver
+	query          QueryFunc
+	credentials    *cachingProvider // see SetCredentialsProvider
+	signing        *Credentials     // the credentials used for DB.Client (guarded by clientLock)
+	endpointErr    error            // see SetRegion and NewStreamsClientWithResolver
 }
 
 // NewDBClient creates a new DynamoDB client
@@ -45,14 +60,45 @@ func NewDBClient() (db *DBClient) {
 //
 // If region looks like an URL it's used as the endpoint URL (and the region is derived from it)
 //
+// If the region is unknown all requests will fail with an "unknown region" error
+// (use ResolveRegion to get the error immediately)
+//
 func (db *DBClient) SetRegion(region string) *DBClient {
+	db.endpointErr = db.ResolveRegion(region)
+	return db
+}
 
-	if !strings.Contains(region, "/") {
-		// not a URL
-		region = Regions[region]
+//
+// ResolveRegion is like SetRegion, but returns an error (and leaves the client unchanged) if the region is unknown
+//
+func (db *DBClient) ResolveRegion(region string) error {
+	if strings.Contains(region, "/") {
+		// a URL
+		db.URL = region
+		if r := RegionFromURL(region); len(r) > 0 {
+			db.Region = r
+		}
+		db.endpointErr = nil
+		return nil
 	}
-	db.URL = region
-	return db
+
+	return db.SetRegionWithResolver(region, DefaultResolver)
+}
+
+//
+// SetRegionWithResolver sets the region and the endpoint URL returned by the resolver
+// (i.e. for FIPS or dual-stack endpoints)
+//
+func (db *DBClient) SetRegionWithResolver(region string, resolver *EndpointResolver) error {
+	url, err := resolver.Resolve(SERVICE_DYNAMODB, region)
+	if err != nil {
+		return err
+	}
+
+	db.URL = url
+	db.Region = region
+	db.endpointErr = nil
+	return nil
 }
 
 //
@@ -63,11 +109,7 @@ func (db *DBClient) SetRegion(region string) *DBClient {
 func (db *DBClient) SetRegionAndURL(region, url string) *DBClient {
 	db.URL = url
 	db.Region = region
-
-	if strings.Contains(url, "/streams.") { // Ugly temp hack!
-		db.Target = "DynamoDBStreams"
-	}
-
+	db.endpointErr = nil
 	return db
 }
 
@@ -76,15 +118,47 @@ func (db *DBClient) SetRegionAndURL(region, url string) *DBClient {
 // try to get them from the environment
 //
 func (db *DBClient) SetCredentials(accessKey, secretKey string) *DBClient {
-	db.Client = &aws4.Client{Keys: &aws4.Keys{AccessKey: accessKey, SecretKey: secretKey}}
+	db.credentials = nil
+	db.setClient(&aws4.Client{Keys: &aws4.Keys{AccessKey: accessKey, SecretKey: secretKey}})
 	return db
 }
 
+func (db *DBClient) setClient(client *aws4.Client) {
+	db.clientLock.Lock()
+	db.Client = client
+	db.clientLock.Unlock()
+}
+
+//
+// snapshot returns a copy of the client configuration, safe to use while the credentials are refreshed
+//
+func (db *DBClient) snapshot() *dydb.DB {
+	db.clientLock.RLock()
+	d := db.DB
+	db.clientLock.RUnlock()
+
+	return &d
+}
+
 //
 // Query executes a DynamoDB query
 //
 func (db *DBClient) Query(action string, v interface{}) dydb.Decoder {
-	return db.DB.RetryQuery(action, v, RETRY_COUNT)
+	if db.endpointErr != nil {
+		return errorDecoder{db.endpointErr}
+	}
+
+	if db.credentials != nil {
+		if err := db.refreshCredentials(); err != nil {
+			return errorDecoder{err}
+		}
+	}
+
+	if db.query != nil {
+		return db.chainQuery(action, v)
+	}
+
+	return db.snapshot().RetryQuery(action, v, RETRY_COUNT)
 }
 
 //
@@ -20,6 +20,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
 	"strings"
@@ -41,6 +42,10 @@ const (
 // region=us-west-1
 // accessKey=XXXXXXXX
 // secretKey=YYYYYYYY
+//
+// If accessKey is not set the credentials are read from the environment
+// or from the AWS shared files (~/.aws/credentials, ~/.aws/config), using the profile
+// specified by awsProfile (or AWS_PROFILE)
 
 type Config struct {
 	Dynago struct {
@@ -50,10 +55,11 @@ type Config struct {
 
 	// list of named profiles
 	Profile map[string]*struct {
-		URL       string
-		Region    string
-		AccessKey string
-		SecretKey string
+		URL        string
+		Region     string
+		AccessKey  string
+		SecretKey  string
+		AwsProfile string
 	}
 }
 
@@ -211,6 +217,15 @@ func (ad *AttrDefinitions) String() string {
 	return "name:type,name:type"
 }
 
+// keyValue converts a key value from the command line to the type of the key attribute
+func keyValue(attr *dynago.AttributeDefinition, value string) interface{} {
+	if attr != nil && attr.AttributeType == dynago.NUMBER_ATTRIBUTE {
+		return json.Number(value)
+	}
+
+	return value
+}
+
 func jsonString(v interface{}) string {
 	res, _ := json.Marshal(v)
 	return string(res)
@@ -232,7 +247,8 @@ func networkError(err error) bool {
 
 func main() {
 	env := flag.String("env", "", "select environment/profile")
-	debug := flag.Bool("debug", false, "enable/disable debug mode")
+	debug := flag.Bool("debug", false, "enable/disable debug mode (log requests and responses)")
+	debugHttp := flag.Bool("debughttp", false, "log raw HTTP requests and responses (including credentials)")
 	prompt := flag.Bool("prompt", true, "enable/disable prompt")
 
 	flag.Parse()
@@ -247,17 +263,32 @@ func main() {
 	}
 
 	if *debug {
+		db.SetLogger(os.Stderr, dynago.LgBodies(true))
+	}
+
+	if *debugHttp {
 		httpclient.StartLogging(true, true)
 	}
 
 	if len(profile.URL) > 0 {
 		db.SetRegionAndURL(profile.Region, profile.URL)
 	} else if len(profile.Region) > 0 {
-		db.SetRegion(profile.Region)
+		if err := db.ResolveRegion(profile.Region); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	if len(profile.AccessKey) > 0 {
 		db.SetCredentials(profile.AccessKey, profile.SecretKey)
+	} else {
+		// only use the chain if it finds some credentials, so that profiles
+		// for DynamoDB Local that have none keep working (with unsigned requests)
+		chain := dynago.DefaultCredentialsChain(profile.AwsProfile)
+		if _, err := chain.Retrieve(); err == nil {
+			db.SetCredentialsProvider(chain)
+		} else if err != dynago.ERR_NO_CREDENTIALS {
+			log.Println("credentials:", err)
+		}
 	}
 
 	commander := &cmd.Cmd{HistoryFile: HISTORY_FILE, Complete: CompletionFunction, EnableShell: true}
@@ -562,7 +593,7 @@ func main() {
 				fmt.Println(err)
 			} else {
 				pretty.PrettyPrint(item)
-				fmt.Println("consumed:", consumed)
+				fmt.Println("consumed:", jsonString(consumed))
 			}
 
 			return
@@ -610,7 +641,7 @@ func main() {
 				fmt.Println(err)
 			} else {
 				pretty.PrettyPrint(item)
-				fmt.Println("consumed:", consumed)
+				fmt.Println("consumed:", jsonString(consumed))
 			}
 
 			return
@@ -686,7 +717,7 @@ func main() {
 				fmt.Println(err)
 			} else {
 				pretty.PrettyPrint(item)
-				fmt.Println("consumed:", consumed)
+				fmt.Println("consumed:", jsonString(consumed))
 			}
 
 			return
@@ -737,7 +768,7 @@ func main() {
 				fmt.Println()
 			} else {
 				pretty.PrettyPrint(item)
-				fmt.Println("consumed:", consumed)
+				fmt.Println("consumed:", jsonString(consumed))
 			}
 
 			return
@@ -746,12 +777,14 @@ func main() {
 
 	commander.Add(cmd.Command{"query",
 		`
-		query [--table=tablename] [--limit=pagesize] [--next] [--count] [--consumed] --hash hash-key-value [--range[-rangeop] range-key-value]
+		query [--table=tablename] [--index=indexname [--fetch]] [--limit=pagesize] [--next] [--count] [--consumed] --hash hash-key-value [--range[-rangeop] range-key-value]
 		`,
 		func(line string) (stop bool) {
 			flags := args.NewFlags("query")
 
 			tableName := flags.String("table", "", "table name")
+			index := flags.String("index", "", "secondary index name")
+			fetch := flags.Bool("fetch", false, "get the full items for indexes that don't project all the attributes")
 			limit := flags.Int("limit", 0, "maximum number of items per page")
 			count := flags.Bool("count", false, "only return item count")
 			next := flags.Bool("next", false, "get next page")
@@ -801,14 +834,32 @@ func main() {
 				}
 			}
 
-			query := table.Query(*hashKey)
+			var query *dynago.QueryRequest
 
-			if len(rangeCond.Operator) > 0 {
-				switch rangeCond.Operator {
-				case "NULL", "NOT_NULL":
-					query.SetAttrCondition(table.RangeKey().Condition(rangeCond.Operator))
-				default:
-					query.SetAttrCondition(table.RangeKey().Condition(rangeCond.Operator, rangeCond.Value))
+			if len(*index) > 0 {
+				def := table.Index(*index)
+				if def == nil {
+					fmt.Println("unknown index", *index)
+					return
+				}
+
+				query = table.QueryIndex(*index, keyValue(def.HashKey, *hashKey))
+
+				if len(rangeCond.Operator) > 0 {
+					query.SetRangeCondition(rangeCond.Operator, keyValue(def.RangeKey, rangeCond.Value))
+				}
+
+				query.SetFetchItems(*fetch)
+			} else {
+				query = table.Query(*hashKey)
+
+				if len(rangeCond.Operator) > 0 {
+					switch rangeCond.Operator {
+					case "NULL", "NOT_NULL":
+						query.SetAttrCondition(table.RangeKey().Condition(rangeCond.Operator))
+					default:
+						query.SetAttrCondition(table.RangeKey().Condition(rangeCond.Operator, rangeCond.Value))
+					}
 				}
 			}
 
@@ -835,7 +886,7 @@ func main() {
 				fmt.Println(err)
 			} else {
 				pretty.PrettyPrint(items)
-				fmt.Println("consumed:", consumed)
+				fmt.Println("consumed:", jsonString(consumed))
 
 				nextKey = lastKey
 			}
@@ -920,7 +971,7 @@ func main() {
 					fmt.Println("count:", totalCount)
 					fmt.Println("scan count:", scanCount)
 					if *cons {
-						fmt.Println("consumed:", consumed)
+						fmt.Println("consumed:", jsonString(consumed))
 					}
 				}
 
@@ -984,7 +1035,7 @@ func main() {
 
 					if *cons {
 						log.Println("count:", len(items))
-						log.Println("consumed:", consumed)
+						log.Println("consumed:", jsonString(consumed))
 					}
 
 					if remaining > 0 {
@@ -1015,6 +1066,159 @@ func main() {
 		},
 		nil})
 
+	commander.Add(cmd.Command{"export",
+		`
+		export [--table=tablename] [--format=json|dynamodb] [--gzip] [--segments=n] [--rate=rcu] {file} : export table to JSON lines file
+		`,
+		func(line string) (stop bool) {
+			flags := args.NewFlags("export")
+
+			tableName := flags.String("table", "", "table name")
+			format := flags.String("format", dynago.EXPORT_JSON, "export format: json or dynamodb")
+			compress := flags.Bool("gzip", false, "compress output")
+			segments := flags.Int("segments", 1, "number of parallel scan segments")
+			rate := flags.Float64("rate", 0, "maximum read capacity units per second")
+
+			if err := args.ParseFlags(flags, line); err != nil {
+				return
+			}
+
+			args := flags.Args()
+			if len(args) != 1 {
+				fmt.Println("one parameter (file name) required")
+				return
+			}
+
+			table := getTable(*tableName)
+			if table == nil {
+				return
+			}
+
+			manifest, err := db.ExportTable(table.Name, args[0],
+				dynago.ExFormat(*format),
+				dynago.ExGzip(*compress),
+				dynago.ExSegments(*segments),
+				dynago.ExRateLimit(*rate))
+
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Println("exported:", manifest.ItemCount)
+				fmt.Println("consumed:", manifest.ConsumedCapacity)
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"import",
+		`
+		import [--table=tablename] [--format=json|dynamodb|csv] [--types=name:type,name:type] [--validate] [--rate=wcu] [--offset=file] {file} : import items from JSON lines or CSV file
+		`,
+		func(line string) (stop bool) {
+			flags := args.NewFlags("import")
+
+			tableName := flags.String("table", "", "table name")
+			format := flags.String("format", dynago.IMPORT_JSON, "import format: json, dynamodb or csv")
+			validate := flags.Bool("validate", false, "validate item keys")
+			rate := flags.Float64("rate", 0, "maximum write capacity units per second")
+			offset := flags.String("offset", "", "file used to record/resume the import progress")
+
+			types := AttrDefinitions{attrs: []dynago.AttributeDefinition{}}
+			flags.Var(&types, "types", "CSV column types")
+
+			if err := args.ParseFlags(flags, line); err != nil {
+				return
+			}
+
+			args := flags.Args()
+			if len(args) != 1 {
+				fmt.Println("one parameter (file name) required")
+				return
+			}
+
+			table := getTable(*tableName)
+			if table == nil {
+				return
+			}
+
+			columns := map[string]string{}
+			for _, t := range types.attrs {
+				columns[t.AttributeName] = t.AttributeType
+			}
+
+			progress, err := table.ImportFile(args[0],
+				dynago.ImFormat(*format),
+				dynago.ImColumnTypes(columns),
+				dynago.ImValidate(*validate),
+				dynago.ImRateLimit(*rate),
+				dynago.ImOffsetFile(*offset),
+				dynago.ImProgress(func(p dynago.ImportProgress) {
+					if *debug {
+						log.Println("lines:", p.Lines, "items:", p.Items, "consumed:", p.Consumed)
+					}
+				}))
+
+			if err != nil {
+				fmt.Println(err)
+			}
+
+			if progress != nil {
+				fmt.Println("imported:", progress.Items)
+				fmt.Println("consumed:", progress.Consumed)
+			}
+
+			return
+		},
+		nil})
+
+	commander.Add(cmd.Command{"execute",
+		`
+		execute [--consistent] [--consumed] [--params={json-array}] {statement} : execute PartiQL statement
+		`,
+		func(line string) (stop bool) {
+			flags := args.NewFlags("execute")
+
+			consistent := flags.Bool("consistent", false, "consistent read")
+			cons := flags.Bool("consumed", false, "return consumed capacity")
+			params := flags.String("params", "", `statement parameters (json: [value, value])`)
+
+			if err := args.ParseFlags(flags, line); err != nil {
+				return
+			}
+
+			args := flags.Args()
+			if len(args) == 0 {
+				fmt.Println("missing statement")
+				return
+			}
+
+			var plist []interface{}
+
+			if len(*params) > 0 {
+				if err := json.Unmarshal([]byte(*params), &plist); err != nil {
+					fmt.Printf("can't parse %q %v\n", *params, err)
+					return
+				}
+			}
+
+			statement := dynago.Statement(strings.Join(args, " "), plist...).
+				SetConsistentRead(*consistent).
+				SetConsumed(*cons)
+
+			if items, consumed, err := statement.ExecAll(db); err != nil {
+				fmt.Println(err)
+			} else {
+				pretty.PrettyPrint(items)
+				if *cons {
+					fmt.Println("consumed:", jsonString(consumed))
+				}
+			}
+
+			return
+		},
+		nil})
+
 	commander.Add(cmd.Command{"listStreams",
 		`
                 listStreams : display list of available streams
@@ -1024,6 +1228,7 @@ func main() {
 
 			tableName := flags.String("table", "", "table name")
 			limit := flags.Int("limit", 0, "maximum number of items per page")
+			start := flags.String("start", "", "start after this stream ARN")
 
 			if err := args.ParseFlags(flags, line); err != nil {
 				return
@@ -1039,7 +1244,11 @@ func main() {
 				options = append(options, dynago.LsLimit(*limit))
 			}
 
-			streams, err := db.ListStreams(options...)
+			if len(*start) > 0 {
+				options = append(options, dynago.LsStartArn(*start))
+			}
+
+			streams, last, err := dynago.NewStreamsClient(db).ListStreams(options...)
 
 			if err != nil {
 				fmt.Println(err)
@@ -1049,11 +1258,16 @@ func main() {
 			if len(streams) > 0 {
 				fmt.Println("Available streams")
 
+				stream_list = nil
+
 				for i, s := range streams {
-					fmt.Println(i, s)
+					fmt.Println(i, s.StreamArn, s.TableName, s.StreamLabel)
+					stream_list = append(stream_list, s.StreamArn)
 				}
 
-				stream_list = streams
+				if len(last) > 0 {
+					fmt.Println("more streams after", last)
+				}
 			} else {
 				fmt.Println("No available streams")
 			}
@@ -1064,7 +1278,7 @@ func main() {
 
 	commander.Add(cmd.Command{"describeStream",
 		`
-                describeStream {streamId} : display stream information
+                describeStream {streamArn} : display stream information
                 `,
 		func(line string) (stop bool) {
 			flags := args.NewFlags("describeStream")
@@ -1082,7 +1296,7 @@ func main() {
 				return
 			}
 
-			streamId := getStream(args[0])
+			streamArn := getStream(args[0])
 
 			options := []dynago.DescribeStreamOption{}
 
@@ -1094,7 +1308,7 @@ func main() {
 				options = append(options, dynago.DsLimit(*limit))
 			}
 
-			stream, err := db.DescribeStream(streamId, options...)
+			stream, err := dynago.NewStreamsClient(db).DescribeStream(streamArn, options...)
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -1108,7 +1322,7 @@ func main() {
 
 	commander.Add(cmd.Command{"streamRecords",
 		`
-                streamRecords {streamId} : display stream records
+                streamRecords [--type=last|latest|at|after [--shard=shardId --seq=sequence]] [--checkpoint=file] [--follow [--wait=duration] [--maxwait=duration]] {streamArn} : display stream records
                 `,
 		func(line string) (stop bool) {
 			flags := args.NewFlags("streamRecords")
@@ -1117,11 +1331,13 @@ func main() {
 			itype := flags.String("type", "last", "shard iterator type (last, latest, at, after)")
 			iseq := flags.String("seq", "", "sequence number")
 			verbose := flags.Bool("verbose", false, "display full records")
+			checkpoint := flags.String("checkpoint", "", "file used to store/resume the stream position")
 
-			//follow := flags.Bool("follow", false, "follow iterator")
-			//wait := flags.Duration("wait", time.Second, "time to wait if --follow and no new records")
+			follow := flags.Bool("follow", false, "follow iterator")
+			wait := flags.Duration("wait", time.Second, "time to wait if --follow and no new records")
+			maxWait := flags.Duration("maxwait", 30*time.Second, "maximum time to wait if --follow and no new records")
+			shardId := flags.String("shard", "", "shard id (for --type=at|after)")
 			//iter := flags.String("iter", "", "use this shard iterator")
-			//shardId := flags.String("shard", "", "shard id")
 
 			if err := args.ParseFlags(flags, line); err != nil {
 				return
@@ -1138,77 +1354,100 @@ func main() {
 				*itype = dynago.LATEST
 			}
 
-			args := flags.Args()
-			if len(args) == 0 {
-				fmt.Println("missing stream id")
+			if (*itype == dynago.AT_SEQUENCE || *itype == dynago.AFTER_SEQUENCE) && (len(*shardId) == 0 || len(*iseq) == 0) {
+				fmt.Println("--type=at|after requires --shard and --seq")
 				return
 			}
 
-			streamId := getStream(args[0])
-			stream, err := db.DescribeStream(streamId)
-			if err != nil {
-				fmt.Println(err)
+			args := flags.Args()
+			if len(args) == 0 {
+				fmt.Println("missing stream ARN")
 				return
 			}
 
-			for _, shard := range stream.Shards {
-				last := len(shard.SequenceNumberRange.EndingSequenceNumber) == 0
+			streamArn := getStream(args[0])
+			options := []dynago.StreamReaderOption{
+				dynago.SrIterator(*itype, *shardId, *iseq),
+				dynago.SrLimit(*limit),
+				dynago.SrWait(*wait, *maxWait),
+			}
 
-				iterator, err := db.GetShardIterator(streamId, shard.ShardId, *itype, *iseq)
+			if len(*checkpoint) > 0 {
+				store, err := dynago.NewFileCheckpointStore(*checkpoint)
 				if err != nil {
 					fmt.Println(err)
 					return
 				}
 
-				for {
-					records, err := db.GetRecords(iterator, *limit)
-					if err != nil {
-						fmt.Println(err)
-						return
-					} else {
-						if *verbose {
-							pretty.PrettyPrint(records)
-						} else {
-							for _, r := range records.Records {
-								op := r.EventName
-								values := r.Dynamodb
-								s := values.SequenceNumber
-
-								switch values.StreamViewType {
-								case dynago.STREAM_VIEW_OLD:
-									if len(values.OldImage) > 0 {
-										fmt.Println(s, op, pretty.PrettyFormat(values.OldImage))
-									} else {
-										fmt.Println(s, op, "key", pretty.PrettyFormat(values.Keys))
-									}
-
-								case dynago.STREAM_VIEW_NEW:
-									if len(values.NewImage) > 0 {
-										fmt.Println(s, op, pretty.PrettyFormat(values.NewImage))
-									} else {
-										fmt.Println(s, op, "key", pretty.PrettyFormat(values.Keys))
-									}
-
-								case dynago.STREAM_VIEW_KEYS:
-									fmt.Println(s, op, pretty.PrettyFormat(values.Keys))
-
-								case dynago.STREAM_VIEW_ALL:
-									fmt.Println(s, op,
-										"old", pretty.PrettyFormat(values.OldImage),
-										"new", pretty.PrettyFormat(values.NewImage))
-								}
-
-							}
+				options = append(options, dynago.SrCheckpoint(store))
+			}
 
-						}
+			reader := dynago.NewStreamsClient(db).NewStreamReader(streamArn, options...)
+
+			handler := func(shardId string, r dynago.Record) error {
+				if *verbose {
+					pretty.PrettyPrint(r)
+					return nil
+				}
 
-						iterator = records.NextShardIterator
+				op := r.EventName
+				values := r.Dynamodb
+				s := values.SequenceNumber
+
+				switch values.StreamViewType {
+				case dynago.STREAM_VIEW_OLD:
+					if len(values.OldImage) > 0 {
+						fmt.Println(s, op, pretty.PrettyFormat(values.OldImage))
+					} else {
+						fmt.Println(s, op, "key", pretty.PrettyFormat(values.Keys))
 					}
 
-					if len(iterator) == 0 || last {
-						break
+				case dynago.STREAM_VIEW_NEW:
+					if len(values.NewImage) > 0 {
+						fmt.Println(s, op, pretty.PrettyFormat(values.NewImage))
+					} else {
+						fmt.Println(s, op, "key", pretty.PrettyFormat(values.Keys))
 					}
+
+				case dynago.STREAM_VIEW_KEYS:
+					fmt.Println(s, op, pretty.PrettyFormat(values.Keys))
+
+				case dynago.STREAM_VIEW_ALL:
+					fmt.Println(s, op,
+						"old", pretty.PrettyFormat(values.OldImage),
+						"new", pretty.PrettyFormat(values.NewImage))
 				}
+
+				return nil
+			}
+
+			var err error
+
+			if *follow {
+				// stop following on ^C
+				stop := make(chan struct{})
+				done := make(chan struct{})
+				interrupt := make(chan os.Signal, 1)
+				signal.Notify(interrupt, os.Interrupt)
+
+				go func() {
+					select {
+					case <-interrupt:
+						close(stop)
+					case <-done:
+					}
+				}()
+
+				err = reader.Follow(handler, stop)
+
+				signal.Stop(interrupt)
+				close(done)
+			} else {
+				err = reader.Read(handler)
+			}
+
+			if err != nil {
+				fmt.Println(err)
 			}
 
 			return
@@ -1218,6 +1457,7 @@ func main() {
 	commander.Commands["modify"] = commander.Commands["updateTable"]
 	commander.Commands["dt"] = commander.Commands["describe"]
 	commander.Commands["ls"] = commander.Commands["list"]
+	commander.Commands["sql"] = commander.Commands["execute"]
 	commander.Commands["rm"] = commander.Commands["remove"]
 	commander.Commands["lss"] = commander.Commands["listStreams"]
 	commander.Commands["ds"] = commander.Commands["describeStream"]
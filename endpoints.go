@@ -0,0 +1,218 @@
+package dynago
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	SERVICE_DYNAMODB = "dynamodb"
+	SERVICE_STREAMS  = "streams.dynamodb"
+)
+
+var (
+	// the resolver used by DBClient.SetRegion
+	DefaultResolver = NewEndpointResolver()
+
+	ERR_UNKNOWN_REGION = errors.New("unknown region")
+	ERR_NO_DUALSTACK   = errors.New("dual-stack endpoints not available in this partition")
+	ERR_NO_FIPS        = errors.New("FIPS endpoints not available in this region")
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Endpoint resolver
+//
+
+//
+// Partition is a group of AWS regions sharing the same domain
+//
+type Partition struct {
+	Name            string
+	DNSSuffix       string
+	DualStackSuffix string   // empty if dual-stack endpoints are not available
+	FIPSRegions     []string // the regions where FIPS endpoints are available
+	Regions         []string
+}
+
+//
+// HasFIPS returns true if FIPS endpoints are available in the region
+//
+func (p *Partition) HasFIPS(region string) bool {
+	for _, r := range p.FIPSRegions {
+		if r == region {
+			return true
+		}
+	}
+
+	return false
+}
+
+var Partitions = []*Partition{
+	&Partition{
+		Name:            "aws",
+		DNSSuffix:       "amazonaws.com",
+		DualStackSuffix: "api.aws",
+		FIPSRegions:     []string{"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "ca-west-1"},
+		Regions: []string{
+			"us-east-1", "us-east-2", "us-west-1", "us-west-2",
+			"af-south-1",
+			"ap-east-1", "ap-east-2",
+			"ap-south-1", "ap-south-2",
+			"ap-southeast-1", "ap-southeast-2", "ap-southeast-3", "ap-southeast-4", "ap-southeast-5", "ap-southeast-6", "ap-southeast-7",
+			"ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+			"ca-central-1", "ca-west-1",
+			"eu-central-1", "eu-central-2",
+			"eu-west-1", "eu-west-2", "eu-west-3",
+			"eu-south-1", "eu-south-2",
+			"eu-north-1",
+			"il-central-1",
+			"me-south-1", "me-central-1",
+			"mx-central-1",
+			"sa-east-1",
+		},
+	},
+	&Partition{
+		Name:            "aws-cn",
+		DNSSuffix:       "amazonaws.com.cn",
+		DualStackSuffix: "api.amazonwebservices.com.cn",
+		Regions:         []string{"cn-north-1", "cn-northwest-1"},
+	},
+	&Partition{
+		Name:            "aws-us-gov",
+		DNSSuffix:       "amazonaws.com",
+		DualStackSuffix: "api.aws",
+		FIPSRegions:     []string{"us-gov-west-1", "us-gov-east-1"},
+		Regions:         []string{"us-gov-west-1", "us-gov-east-1"},
+	},
+	&Partition{
+		Name:      "aws-iso",
+		DNSSuffix: "c2s.ic.gov",
+		Regions:   []string{"us-iso-east-1", "us-iso-west-1"},
+	},
+	&Partition{
+		Name:      "aws-iso-b",
+		DNSSuffix: "sc2s.sgov.gov",
+		Regions:   []string{"us-isob-east-1"},
+	},
+	&Partition{
+		Name:      "aws-iso-e",
+		DNSSuffix: "cloud.adc-e.uk",
+		Regions:   []string{"eu-isoe-west-1"},
+	},
+	&Partition{
+		Name:      "aws-iso-f",
+		DNSSuffix: "csp.hci.ic.gov",
+		Regions:   []string{"us-isof-south-1", "us-isof-east-1"},
+	},
+}
+
+//
+// PartitionOf returns the partition the region belongs to
+//
+func PartitionOf(region string) (*Partition, error) {
+	for _, p := range Partitions {
+		for _, r := range p.Regions {
+			if r == region {
+				return p, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%v: %q", ERR_UNKNOWN_REGION, region)
+}
+
+//
+// EndpointResolver returns the endpoint URL for a service (SERVICE_DYNAMODB, SERVICE_STREAMS) in a region
+//
+type EndpointResolver struct {
+	fips      bool
+	dualStack bool
+	overrides map[string]string
+}
+
+func NewEndpointResolver() *EndpointResolver {
+	return &EndpointResolver{overrides: map[string]string{}}
+}
+
+//
+// SetFIPS selects FIPS 140-2 compliant endpoints
+//
+func (r *EndpointResolver) SetFIPS(enable bool) *EndpointResolver {
+	r.fips = enable
+	return r
+}
+
+//
+// SetDualStack selects dual-stack (IPv4 and IPv6) endpoints
+//
+func (r *EndpointResolver) SetDualStack(enable bool) *EndpointResolver {
+	r.dualStack = enable
+	return r
+}
+
+//
+// SetOverride sets a custom endpoint URL for the service, used for all regions
+// (i.e. for DynamoDB Local or a proxy)
+//
+func (r *EndpointResolver) SetOverride(service, url string) *EndpointResolver {
+	r.overrides[service] = url
+	return r
+}
+
+//
+// Resolve returns the endpoint URL for the service in the region,
+// or an error if the region is unknown or the requested endpoint variant is not available
+//
+func (r *EndpointResolver) Resolve(service, region string) (string, error) {
+	if url, ok := r.overrides[service]; ok {
+		return url, nil
+	}
+
+	p, err := PartitionOf(region)
+	if err != nil {
+		return "", err
+	}
+
+	host := service
+
+	if r.fips {
+		if !p.HasFIPS(region) {
+			return "", ERR_NO_FIPS
+		}
+
+		// dynamodb-fips.region, streams.dynamodb-fips.region
+		host += "-fips"
+	}
+
+	suffix := p.DNSSuffix
+
+	if r.dualStack {
+		if len(p.DualStackSuffix) == 0 {
+			return "", ERR_NO_DUALSTACK
+		}
+
+		suffix = p.DualStackSuffix
+	}
+
+	return fmt.Sprintf("https://%v.%v.%v/", host, region, suffix), nil
+}
+
+//
+// RegionFromURL returns the region from a standard endpoint URL (empty if it can't be determined)
+//
+func RegionFromURL(url string) string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	if i := strings.IndexAny(url, "/:"); i >= 0 {
+		url = url[:i]
+	}
+
+	for _, part := range strings.Split(url, ".") {
+		if _, err := PartitionOf(part); err == nil {
+			return part
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,307 @@
+package dynago
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	EXPORT_JSON          = "json"     // plain JSON (decoded items)
+	EXPORT_DYNAMODB_JSON = "dynamodb" // typed DynamoDB JSON (AttributeNameValue)
+
+	MANIFEST_SUFFIX = ".manifest.json"
+)
+
+var (
+	ERR_INVALID_FORMAT = errors.New("invalid format")
+)
+
+//
+// ExportManifest describes an export file. It's written next to the export file
+// (with the MANIFEST_SUFFIX extension)
+//
+type ExportManifest struct {
+	TableName        string
+	Format           string
+	Compressed       bool
+	ItemCount        int64
+	ConsumedCapacity float32
+	StartTime        time.Time
+	EndTime          time.Time
+	Table            TableDescription
+}
+
+//
+// ReadManifest reads the manifest for an export file
+//
+func ReadManifest(path string) (*ExportManifest, error) {
+	f, err := os.Open(path + MANIFEST_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var manifest ExportManifest
+
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (manifest *ExportManifest) write(path string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path + MANIFEST_SUFFIX)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// ExportTable
+//
+
+type exportRequest struct {
+	format   string
+	compress bool
+	segments int
+	pageSize int
+	rate     float64
+}
+
+type ExportOption func(*exportRequest)
+
+//
+// ExFormat sets the export format (EXPORT_JSON or EXPORT_DYNAMODB_JSON)
+//
+func ExFormat(format string) ExportOption {
+	return func(req *exportRequest) {
+		req.format = format
+	}
+}
+
+func ExGzip(compress bool) ExportOption {
+	return func(req *exportRequest) {
+		req.compress = compress
+	}
+}
+
+//
+// ExSegments sets the number of segments scanned in parallel
+//
+func ExSegments(segments int) ExportOption {
+	return func(req *exportRequest) {
+		req.segments = segments
+	}
+}
+
+func ExPageSize(size int) ExportOption {
+	return func(req *exportRequest) {
+		req.pageSize = size
+	}
+}
+
+//
+// ExRateLimit sets the maximum read capacity units consumed per second (for all segments)
+//
+func ExRateLimit(unitsPerSecond float64) ExportOption {
+	return func(req *exportRequest) {
+		req.rate = unitsPerSecond
+	}
+}
+
+//
+// ExportTable scans a table and writes all the items to a JSON Lines file (one item per line),
+// and a manifest file with the item count and the table description
+//
+func (db *DBClient) ExportTable(tableName, path string, options ...ExportOption) (*ExportManifest, error) {
+	req := exportRequest{format: EXPORT_JSON, segments: 1}
+
+	for _, option := range options {
+		option(&req)
+	}
+
+	if req.format != EXPORT_JSON && req.format != EXPORT_DYNAMODB_JSON {
+		return nil, ERR_INVALID_FORMAT
+	}
+
+	if req.segments < 1 {
+		req.segments = 1
+	}
+
+	desc, err := db.DescribeTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ExportManifest{
+		TableName:  tableName,
+		Format:     req.format,
+		Compressed: req.compress,
+		StartTime:  time.Now(),
+		Table:      *desc,
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+
+	if req.compress {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+
+	out := &exportWriter{w: bufio.NewWriter(w), format: req.format}
+	limiter := newRateLimiter(req.rate)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+
+	for segment := 0; segment < req.segments; segment++ {
+		wg.Add(1)
+
+		go func(segment int) {
+			defer wg.Done()
+
+			scan := Scan(tableName).SetConsumed(true)
+			if req.segments > 1 {
+				scan.SetSegment(segment, req.segments)
+			}
+			if req.pageSize > 0 {
+				scan.SetLimit(req.pageSize)
+			}
+
+			serr := scan.each(db, limiter, func(items []AttributeNameValue, consumed float32) error {
+				lock.Lock()
+				manifest.ItemCount += int64(len(items))
+				manifest.ConsumedCapacity += consumed
+				lock.Unlock()
+
+				return out.write(items)
+			})
+
+			if serr != nil {
+				lock.Lock()
+				if err == nil {
+					err = serr
+				}
+				lock.Unlock()
+			}
+		}(segment)
+	}
+
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := out.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	manifest.EndTime = time.Now()
+
+	if err := manifest.write(path); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+//
+// each calls f for every page of the scan, waiting on the rate limiter after every page
+//
+func (req *ScanRequest) each(db *DBClient, limiter *rateLimiter, f func(items []AttributeNameValue, consumed float32) error) error {
+	sreq := *req
+
+	for {
+		items, lastKey, consumed, err := sreq.ExecRaw(db)
+		if err != nil {
+			return err
+		}
+
+		if err := f(items, consumed.CapacityUnits); err != nil {
+			return err
+		}
+
+		if len(lastKey) == 0 {
+			return nil
+		}
+
+		sreq.ExclusiveStartKey = lastKey
+		limiter.wait(float64(consumed.CapacityUnits))
+	}
+}
+
+type exportWriter struct {
+	lock   sync.Mutex
+	w      *bufio.Writer
+	format string
+}
+
+func (out *exportWriter) write(items []AttributeNameValue) error {
+	out.lock.Lock()
+	defer out.lock.Unlock()
+
+	for _, item := range items {
+		var data []byte
+		var err error
+
+		if out.format == EXPORT_DYNAMODB_JSON {
+			data, err = json.Marshal(item)
+		} else {
+			data, err = json.Marshal(DecodeItem(item))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := out.w.Write(data); err != nil {
+			return err
+		}
+
+		if err := out.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
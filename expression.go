@@ -0,0 +1,930 @@
+package dynago
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//
+// Expression is a parsed condition/filter expression that can be evaluated locally on an item.
+//
+// It supports the DynamoDB condition expression syntax: comparisons (= <> < <= > >=),
+// BETWEEN, IN, AND, OR, NOT, parentheses, the functions attribute_exists, attribute_not_exists,
+// attribute_type, begins_with, contains and size, expression attribute names (#name)
+// and expression attribute values (:value).
+//
+type Expression struct {
+	expr string
+	root exprNode
+}
+
+var (
+	ERR_EXPRESSION_SYNTAX = errors.New("invalid expression")
+)
+
+//
+// ParseExpression parses a condition expression. names and values are the expression attribute names and values
+// (as for ExpressionAttributeNames and ExpressionAttributeValues)
+//
+func ParseExpression(expr string, names map[string]string, values map[string]interface{}) (*Expression, error) {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens, names: names, values: values}
+
+	root, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tkEnd {
+		return nil, p.errorf("unexpected %q", t.text)
+	}
+
+	return &Expression{expr: expr, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.expr
+}
+
+//
+// Match evaluates the expression on the item.
+//
+// Decoded items don't preserve all the DynamoDB types (i.e. string sets are decoded as lists),
+// so use MatchAttributes for attribute_type checks on sets when the typed values are available.
+//
+func (e *Expression) Match(item Item) bool {
+	return e.root.eval(item)
+}
+
+//
+// MatchAttributes evaluates the expression on an item with DynamoDB typed values
+//
+func (e *Expression) MatchAttributes(item AttributeNameValue) bool {
+	return e.root.eval(typedItem(item))
+}
+
+//
+// typedItem decodes the item values with decodeTyped (nil for a nil item)
+//
+func typedItem(item AttributeNameValue) Item {
+	if item == nil {
+		return nil
+	}
+
+	typed := Item{}
+	for k, v := range item {
+		typed[k] = decodeTyped(v)
+	}
+
+	return typed
+}
+
+// sets, as decoded by decodeTyped
+type stringSet []string
+type numberSet []json.Number
+type binarySet [][]byte
+
+//
+// decodeTyped decodes a value preserving the DynamoDB type
+// (numbers as json.Number, binary values as []byte and sets as stringSet, numberSet and binarySet)
+//
+func decodeTyped(av AttributeValue) interface{} {
+	for t, v := range av {
+		switch t {
+		case STRING_ATTRIBUTE:
+			s, _ := v.(string)
+			return s
+
+		case NUMBER_ATTRIBUTE:
+			s, _ := v.(string)
+			return json.Number(s)
+
+		case BINARY_ATTRIBUTE:
+			return decodeBinary(v)
+
+		case BOOLEAN_ATTRIBUTE:
+			b, _ := v.(bool)
+			return b
+
+		case NULL_ATTRIBUTE:
+			return nil
+
+		case STRING_SET_ATTRIBUTE:
+			ss := stringSet{}
+			for _, e := range toList(v) {
+				s, _ := e.(string)
+				ss = append(ss, s)
+			}
+			return ss
+
+		case NUMBER_SET_ATTRIBUTE:
+			ns := numberSet{}
+			for _, e := range toList(v) {
+				s, _ := e.(string)
+				ns = append(ns, json.Number(s))
+			}
+			return ns
+
+		case BINARY_SET_ATTRIBUTE:
+			bs := binarySet{}
+			for _, e := range toList(v) {
+				bs = append(bs, decodeBinary(e))
+			}
+			return bs
+
+		case LIST_ATTRIBUTE:
+			l := []interface{}{}
+			for _, e := range toList(v) {
+				l = append(l, decodeTyped(toAttributeValue(e)))
+			}
+			return l
+
+		case MAP_ATTRIBUTE:
+			m := map[string]interface{}{}
+			switch v := v.(type) {
+			case map[string]interface{}: // from JSON
+				for k, e := range v {
+					m[k] = decodeTyped(toAttributeValue(e))
+				}
+			case map[string]AttributeValue:
+				for k, e := range v {
+					m[k] = decodeTyped(e)
+				}
+			}
+			return m
+		}
+	}
+
+	return nil
+}
+
+func toList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+
+	case []string:
+		l := make([]interface{}, len(v))
+		for i, s := range v {
+			l[i] = s
+		}
+		return l
+
+	case []AttributeValue:
+		l := make([]interface{}, len(v))
+		for i, av := range v {
+			l[i] = av
+		}
+		return l
+	}
+
+	return nil
+}
+
+func toAttributeValue(v interface{}) AttributeValue {
+	switch v := v.(type) {
+	case AttributeValue:
+		return v
+	case map[string]interface{}:
+		return AttributeValue(v)
+	}
+
+	return nil
+}
+
+func decodeBinary(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string: // base64, from JSON
+		b, _ := base64.StdEncoding.DecodeString(v)
+		return b
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// tokenizer
+//
+
+const (
+	tkEnd    = iota
+	tkIdent  // attribute name, keyword or function
+	tkName   // #name
+	tkValue  // :value
+	tkNumber // list index
+	tkPunct  // ( ) , . [ ] = <> < <= > >=
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func tokenizeExpression(expr string) ([]exprToken, error) {
+	tokens := []exprToken{}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '#' || c == ':':
+			start := i
+			for i++; i < len(expr) && isIdentChar(expr[i]); i++ {
+			}
+			if i == start+1 {
+				return nil, fmt.Errorf("%v: missing name at %d", ERR_EXPRESSION_SYNTAX, start)
+			}
+
+			kind := tkName
+			if c == ':' {
+				kind = tkValue
+			}
+
+			tokens = append(tokens, exprToken{kind, expr[start:i], start})
+
+		case c >= '0' && c <= '9':
+			start := i
+			for ; i < len(expr) && expr[i] >= '0' && expr[i] <= '9'; i++ {
+			}
+
+			tokens = append(tokens, exprToken{tkNumber, expr[start:i], start})
+
+		case isIdentChar(c):
+			start := i
+			for ; i < len(expr) && isIdentChar(expr[i]); i++ {
+			}
+
+			tokens = append(tokens, exprToken{tkIdent, expr[start:i], start})
+
+		case c == '<' && i+1 < len(expr) && (expr[i+1] == '>' || expr[i+1] == '='),
+			c == '>' && i+1 < len(expr) && expr[i+1] == '=':
+			tokens = append(tokens, exprToken{tkPunct, expr[i : i+2], i})
+			i += 2
+
+		case strings.IndexByte("(),.[]=<>", c) >= 0:
+			tokens = append(tokens, exprToken{tkPunct, expr[i : i+1], i})
+			i++
+
+		default:
+			return nil, fmt.Errorf("%v: unexpected %q at %d", ERR_EXPRESSION_SYNTAX, c, i)
+		}
+	}
+
+	return append(tokens, exprToken{tkEnd, "", len(expr)}), nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// parser
+//
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	names  map[string]string
+	values map[string]interface{}
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%v: %v at %d", ERR_EXPRESSION_SYNTAX, fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tkEnd {
+		p.pos++
+	}
+	return t
+}
+
+// punct consumes the next token if it's the specified punctuation
+func (p *exprParser) punct(s string) bool {
+	if t := p.peek(); t.kind == tkPunct && t.text == s {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// keyword consumes the next token if it's the specified keyword (case insensitive)
+func (p *exprParser) keyword(k string) bool {
+	if t := p.peek(); t.kind == tkIdent && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *exprParser) expect(s string) error {
+	if !p.punct(s) {
+		return p.errorf("expected %q", s)
+	}
+
+	return nil
+}
+
+// isCall returns true if the next tokens are name followed by "("
+func (p *exprParser) isCall(name string) bool {
+	t := p.peek()
+	if t.kind == tkEnd {
+		return false
+	}
+
+	n := p.tokens[p.pos+1]
+	return t.kind == tkIdent && strings.EqualFold(t.text, name) && n.kind == tkPunct && n.text == "("
+}
+
+func (p *exprParser) parseCondition() (exprNode, error) {
+	left, err := p.parseAnd()
+
+	for err == nil && p.keyword("OR") {
+		var right exprNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &orNode{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+
+	for err == nil && p.keyword("AND") {
+		var right exprNode
+		if right, err = p.parseNot(); err == nil {
+			left = &andNode{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.keyword("NOT") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{cond}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.punct("(") {
+		cond, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		return cond, p.expect(")")
+	}
+
+	for _, f := range []string{"attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains"} {
+		if p.isCall(f) {
+			return p.parseFunction(f)
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tkPunct {
+		switch t.text {
+		case "=", "<>", "<", "<=", ">", ">=":
+			p.next()
+
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			return &compareNode{t.text, left, right}, nil
+		}
+	}
+
+	if p.keyword("BETWEEN") {
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.keyword("AND") {
+			return nil, p.errorf("expected AND")
+		}
+
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return &betweenNode{left, low, high}, nil
+	}
+
+	if p.keyword("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+
+		in := &inNode{value: left}
+
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			in.list = append(in.list, v)
+
+			if !p.punct(",") {
+				break
+			}
+		}
+
+		return in, p.expect(")")
+	}
+
+	return nil, p.errorf("expected comparison")
+}
+
+func (p *exprParser) parseFunction(name string) (exprNode, error) {
+	p.next() // name
+	p.next() // (
+
+	fn := &functionNode{name: strings.ToLower(name)}
+
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+
+	fn.path = path
+
+	switch fn.name {
+	case "attribute_exists", "attribute_not_exists":
+
+	default:
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+
+		if fn.arg, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+	}
+
+	return fn, p.expect(")")
+}
+
+func (p *exprParser) parseOperand() (exprOperand, error) {
+	if t := p.peek(); t.kind == tkValue {
+		p.next()
+
+		v, ok := p.values[t.text]
+		if !ok {
+			return nil, fmt.Errorf("%v: undefined value %v", ERR_EXPRESSION_SYNTAX, t.text)
+		}
+
+		return valueOperand{v}, nil
+	}
+
+	if p.isCall("size") {
+		p.next() // size
+		p.next() // (
+
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+
+		return sizeOperand{path}, p.expect(")")
+	}
+
+	return p.parsePath()
+}
+
+func (p *exprParser) parseName() (string, error) {
+	switch t := p.peek(); t.kind {
+	case tkIdent:
+		p.next()
+		return t.text, nil
+
+	case tkName:
+		p.next()
+		if name, ok := p.names[t.text]; ok {
+			return name, nil
+		}
+
+		return "", fmt.Errorf("%v: undefined name %v", ERR_EXPRESSION_SYNTAX, t.text)
+
+	default:
+		return "", p.errorf("expected attribute name")
+	}
+}
+
+func (p *exprParser) parsePath() (pathOperand, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	path := pathOperand{pathElement{name: name}}
+
+	for {
+		if p.punct(".") {
+			if name, err = p.parseName(); err != nil {
+				return nil, err
+			}
+
+			path = append(path, pathElement{name: name})
+		} else if p.punct("[") {
+			t := p.next()
+			if t.kind != tkNumber {
+				return nil, p.errorf("expected index")
+			}
+
+			index, _ := strconv.Atoi(t.text)
+			path = append(path, pathElement{index: index, isIndex: true})
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		} else {
+			return path, nil
+		}
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// evaluation
+//
+
+type exprNode interface {
+	eval(item Item) bool
+}
+
+type exprOperand interface {
+	value(item Item) (interface{}, bool)
+}
+
+type orNode struct{ left, right exprNode }
+type andNode struct{ left, right exprNode }
+type notNode struct{ cond exprNode }
+
+func (n *orNode) eval(item Item) bool  { return n.left.eval(item) || n.right.eval(item) }
+func (n *andNode) eval(item Item) bool { return n.left.eval(item) && n.right.eval(item) }
+func (n *notNode) eval(item Item) bool { return !n.cond.eval(item) }
+
+type compareNode struct {
+	op          string
+	left, right exprOperand
+}
+
+func (n *compareNode) eval(item Item) bool {
+	a, ok := n.left.value(item)
+	if !ok {
+		return false
+	}
+
+	b, ok := n.right.value(item)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "=":
+		return equalValues(a, b)
+	case "<>":
+		return !equalValues(a, b)
+	}
+
+	c, ok := compareValues(a, b)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+
+	return false
+}
+
+type betweenNode struct {
+	value, low, high exprOperand
+}
+
+func (n *betweenNode) eval(item Item) bool {
+	v, ok1 := n.value.value(item)
+	low, ok2 := n.low.value(item)
+	high, ok3 := n.high.value(item)
+	if !ok1 || !ok2 || !ok3 {
+		return false
+	}
+
+	c1, ok1 := compareValues(v, low)
+	c2, ok2 := compareValues(v, high)
+	return ok1 && ok2 && c1 >= 0 && c2 <= 0
+}
+
+type inNode struct {
+	value exprOperand
+	list  []exprOperand
+}
+
+func (n *inNode) eval(item Item) bool {
+	v, ok := n.value.value(item)
+	if !ok {
+		return false
+	}
+
+	for _, o := range n.list {
+		if lv, ok := o.value(item); ok && equalValues(v, lv) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type functionNode struct {
+	name string
+	path pathOperand
+	arg  exprOperand
+}
+
+func (n *functionNode) eval(item Item) bool {
+	v, exists := n.path.value(item)
+
+	switch n.name {
+	case "attribute_exists":
+		return exists
+	case "attribute_not_exists":
+		return !exists
+	}
+
+	if !exists {
+		return false
+	}
+
+	arg, ok := n.arg.value(item)
+	if !ok {
+		return false
+	}
+
+	switch n.name {
+	case "attribute_type":
+		return valueType(v) == arg
+
+	case "begins_with":
+		s, ok1 := v.(string)
+		prefix, ok2 := arg.(string)
+		return ok1 && ok2 && strings.HasPrefix(s, prefix)
+
+	case "contains":
+		switch v := v.(type) {
+		case string:
+			sub, ok := arg.(string)
+			return ok && strings.Contains(v, sub)
+
+		default:
+			for _, e := range setOrList(v) {
+				if equalValues(e, arg) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+//
+// setOrList returns the elements of a list or set (nil for other values)
+//
+func setOrList(v interface{}) []interface{} {
+	if _, ok := v.([]byte); ok {
+		return nil // binary value
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+
+	l := make([]interface{}, rv.Len())
+	for i := range l {
+		l[i] = rv.Index(i).Interface()
+	}
+
+	return l
+}
+
+type valueOperand struct {
+	v interface{}
+}
+
+func (o valueOperand) value(item Item) (interface{}, bool) {
+	return o.v, true
+}
+
+type sizeOperand struct {
+	path pathOperand
+}
+
+func (o sizeOperand) value(item Item) (interface{}, bool) {
+	v, ok := o.path.value(item)
+	if !ok {
+		return nil, false
+	}
+
+	switch v := v.(type) {
+	case string:
+		return len(v), true
+	case []byte:
+		return len(v), true
+	case map[string]interface{}:
+		return len(v), true
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		return rv.Len(), true // lists and sets
+	}
+
+	return nil, false
+}
+
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type pathOperand []pathElement
+
+func (o pathOperand) value(item Item) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(item)
+
+	for _, e := range o {
+		if e.isIndex {
+			l, ok := current.([]interface{})
+			if !ok || e.index >= len(l) {
+				return nil, false
+			}
+
+			current = l[e.index]
+		} else {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			if current, ok = m[e.name]; !ok {
+				return nil, false
+			}
+		}
+	}
+
+	return current, true
+}
+
+// toNumber converts numeric values to float64
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+func equalValues(a, b interface{}) bool {
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		return ok && na == nb
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues compares numbers or strings, returning false if the values are not comparable
+func compareValues(a, b interface{}) (int, bool) {
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case na < nb:
+			return -1, true
+		case na > nb:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		return strings.Compare(sa, sb), true
+	}
+
+	return 0, false
+}
+
+// valueType returns the DynamoDB type of a decoded value (or of a value decoded by decodeTyped)
+func valueType(v interface{}) string {
+	if v == nil {
+		return NULL_ATTRIBUTE
+	}
+
+	if _, ok := toNumber(v); ok {
+		return NUMBER_ATTRIBUTE
+	}
+
+	switch v.(type) {
+	case string:
+		return STRING_ATTRIBUTE
+	case bool:
+		return BOOLEAN_ATTRIBUTE
+	case []byte:
+		return BINARY_ATTRIBUTE
+	case stringSet, []string:
+		return STRING_SET_ATTRIBUTE
+	case numberSet, []json.Number, []float32, []float64, []int, []int64:
+		return NUMBER_SET_ATTRIBUTE
+	case binarySet, [][]byte:
+		return BINARY_SET_ATTRIBUTE
+	case []interface{}:
+		return LIST_ATTRIBUTE
+	case map[string]interface{}, Item:
+		return MAP_ATTRIBUTE
+	}
+
+	return ""
+}
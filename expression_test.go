@@ -0,0 +1,308 @@
+package dynago
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var (
+	testExprNames = map[string]string{
+		"#m":    "map",
+		"#name": "name",
+		"#dot":  "a.b",
+	}
+
+	testExprValues = map[string]interface{}{
+		":zero":  0,
+		":one":   1,
+		":two":   2.0,
+		":num":   json.Number("42"),
+		":he":    "he",
+		":hello": "hello",
+		":x":     "x",
+		":red":   "red",
+		":S":     "S",
+		":N":     "N",
+		":B":     "B",
+		":L":     "L",
+		":M":     "M",
+		":SS":    "SS",
+		":NS":    "NS",
+		":BS":    "BS",
+		":BOOL":  "BOOL",
+		":NULL":  "NULL",
+		":true":  true,
+	}
+)
+
+func testExprItem() Item {
+	return Item{
+		"one":   1,
+		"num":   json.Number("42"),
+		"name":  "hello",
+		"a.b":   "dotted",
+		"flag":  true,
+		"null":  nil,
+		"bin":   []byte("abc"),
+		"list":  []interface{}{"x", 1},
+		"map":   map[string]interface{}{"list": []interface{}{0, "red"}, "n": 2},
+		"set":   []string{"red", "green"},
+		"nums":  []float32{1, 2},
+		"bytes": [][]byte{[]byte("a")},
+	}
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// AND binds tighter than OR
+		{"one = :one OR one = :zero AND one = :zero", true},
+		{"(one = :one OR one = :zero) AND one = :zero", false},
+		{"one = :zero AND one = :zero OR one = :one", true},
+		{"one = :zero AND (one = :zero OR one = :one)", false},
+
+		// NOT binds tighter than AND
+		{"NOT one = :zero AND one = :one", true},
+		{"NOT (one = :one AND one = :zero)", true},
+		{"NOT one = :one OR one = :one", true},
+		{"NOT (one = :one OR one = :zero)", false},
+
+		// keywords are case insensitive
+		{"one = :one and not one = :zero", true},
+		{"one between :zero and :two", true},
+		{"one BETWEEN :zero AND :two AND name = :hello", true},
+		{"one IN (:zero, :two) OR name IN (:he, :hello)", true},
+	}
+
+	item := testExprItem()
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expr, testExprNames, testExprValues)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := e.Match(item); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestExpressionComparisons(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"one = :one", true},
+		{"one = :two", false},
+		{"one <> :two", true},
+		{"one < :two", true},
+		{"one <= :one", true},
+		{"one > :zero", true},
+		{"one >= :two", false},
+		{"num = :num", true},
+		{"num > :two", true},
+		{"name = :hello", true},
+		{"name > :he", true},
+		{"name < :he", false},
+		{"name = :one", false},
+		{"missing = :one", false},
+		{"missing <> :one", false},
+		{"flag = :true", true},
+		{"one BETWEEN :zero AND :two", true},
+		{"one BETWEEN :two AND :num", false},
+		{"one IN (:zero, :one)", true},
+		{"one IN (:zero, :two)", false},
+	}
+
+	item := testExprItem()
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expr, testExprNames, testExprValues)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := e.Match(item); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestExpressionFunctions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"attribute_exists(name)", true},
+		{"attribute_exists(missing)", false},
+		{"attribute_not_exists(missing)", true},
+		{"attribute_not_exists(map.n)", false},
+
+		{"begins_with(name, :he)", true},
+		{"begins_with(name, :x)", false},
+		{"begins_with(num, :he)", false},
+
+		{"contains(name, :he)", true},
+		{"contains(list, :x)", true},
+		{"contains(list, :one)", true},
+		{"contains(list, :red)", false},
+		{"contains(set, :red)", true},
+		{"contains(nums, :two)", true},
+		{"contains(missing, :x)", false},
+
+		{"size(name) = :two", false},
+		{"size(list) = :two", true},
+		{"size(set) = :two", true},
+		{"size(map) = :two", true},
+		{"size(bin) > :two", true},
+
+		{"attribute_type(name, :S)", true},
+		{"attribute_type(one, :N)", true},
+		{"attribute_type(num, :N)", true},
+		{"attribute_type(flag, :BOOL)", true},
+		{"attribute_type(null, :NULL)", true},
+		{"attribute_type(bin, :B)", true},
+		{"attribute_type(list, :L)", true},
+		{"attribute_type(map, :M)", true},
+		{"attribute_type(set, :SS)", true},
+		{"attribute_type(set, :L)", false},
+		{"attribute_type(nums, :NS)", true},
+		{"attribute_type(bytes, :BS)", true},
+		{"attribute_type(name, :N)", false},
+	}
+
+	item := testExprItem()
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expr, testExprNames, testExprValues)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := e.Match(item); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestExpressionSubstitution(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"#name = :hello", true},
+		{"#dot = :hello", false},
+		{"attribute_exists(#dot)", true},
+		{"attribute_exists(a.b)", false},
+		{"#m.n = :two", true},
+		{"#m.list[1] = :red", true},
+		{"#m.list[0] = :zero", true},
+		{"#m.list[2] = :zero", false},
+		{"size(#m.list) = :two", true},
+		{"#m.n IN (:zero, :two)", true},
+	}
+
+	item := testExprItem()
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expr, testExprNames, testExprValues)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := e.Match(item); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"one =",
+		"one = :undefined",
+		"#undefined = :one",
+		"(one = :one",
+		"one = :one)",
+		"one BETWEEN :zero",
+		"one IN ()",
+		"unknown_function(one)",
+		"begins_with(name)",
+		"one = :one AND",
+		"NOT",
+	}
+
+	for _, expr := range tests {
+		if _, err := ParseExpression(expr, testExprNames, testExprValues); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestExpressionMatchAttributes(t *testing.T) {
+	var item AttributeNameValue
+
+	data := `{
+		"name": {"S": "hello"},
+		"num":  {"N": "42"},
+		"bin":  {"B": "YWJj"},
+		"ss":   {"SS": ["red", "green"]},
+		"ns":   {"NS": ["1", "2"]},
+		"bs":   {"BS": ["YQ=="]},
+		"list": {"L": [{"S": "red"}, {"N": "1"}]},
+		"map":  {"M": {"n": {"N": "2"}, "list": {"L": [{"N": "0"}, {"S": "red"}]}}},
+		"flag": {"BOOL": true},
+		"null": {"NULL": true}
+	}`
+
+	if err := json.Unmarshal([]byte(data), &item); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"attribute_type(name, :S)", true},
+		{"attribute_type(num, :N)", true},
+		{"attribute_type(bin, :B)", true},
+		{"attribute_type(ss, :SS)", true},
+		{"attribute_type(ss, :L)", false},
+		{"attribute_type(ns, :NS)", true},
+		{"attribute_type(bs, :BS)", true},
+		{"attribute_type(list, :L)", true},
+		{"attribute_type(list, :SS)", false},
+		{"attribute_type(map, :M)", true},
+		{"attribute_type(flag, :BOOL)", true},
+		{"attribute_type(null, :NULL)", true},
+
+		{"num = :num", true},
+		{"num > :two", true},
+		{"contains(ss, :red)", true},
+		{"contains(ns, :two)", true},
+		{"contains(list, :red)", true},
+		{"size(ss) = :two", true},
+		{"size(bin) > :two", true},
+		{"#m.n = :two", true},
+		{"#m.list[1] = :red", true},
+	}
+
+	for _, test := range tests {
+		e, err := ParseExpression(test.expr, testExprNames, testExprValues)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+
+		if got := e.MatchAttributes(item); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package dynago
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	IMPORT_JSON          = EXPORT_JSON
+	IMPORT_DYNAMODB_JSON = EXPORT_DYNAMODB_JSON
+	IMPORT_CSV           = "csv"
+
+	maxImportLine = 4 * 1024 * 1024
+)
+
+//
+// ImportProgress reports the status of an import
+//
+type ImportProgress struct {
+	Lines    int64 // lines processed, including the ones skipped when resuming
+	Items    int64 // items written
+	Consumed float32
+}
+
+type importRequest struct {
+	format     string
+	types      map[string]string
+	validate   bool
+	rate       float64
+	offsetFile string
+	progress   func(ImportProgress)
+}
+
+type ImportOption func(*importRequest)
+
+//
+// ImFormat sets the input format (IMPORT_JSON, IMPORT_DYNAMODB_JSON or IMPORT_CSV)
+//
+func ImFormat(format string) ImportOption {
+	return func(req *importRequest) {
+		req.format = format
+	}
+}
+
+//
+// ImColumnTypes sets the attribute type (STRING_ATTRIBUTE, NUMBER_ATTRIBUTE, BOOLEAN_ATTRIBUTE, LIST_ATTRIBUTE,
+// MAP_ATTRIBUTE) for CSV columns. Columns not listed are imported as strings.
+// LIST_ATTRIBUTE and MAP_ATTRIBUTE columns should contain JSON values.
+//
+func ImColumnTypes(types map[string]string) ImportOption {
+	return func(req *importRequest) {
+		req.types = types
+	}
+}
+
+//
+// ImValidate enables validation of the key attributes before writing the items
+//
+func ImValidate(validate bool) ImportOption {
+	return func(req *importRequest) {
+		req.validate = validate
+	}
+}
+
+//
+// ImRateLimit sets the maximum write capacity units consumed per second
+//
+func ImRateLimit(unitsPerSecond float64) ImportOption {
+	return func(req *importRequest) {
+		req.rate = unitsPerSecond
+	}
+}
+
+//
+// ImOffsetFile sets the file used to record the number of lines imported. If the file exists the import
+// skips the lines already imported. The file is removed when the import completes.
+//
+func ImOffsetFile(path string) ImportOption {
+	return func(req *importRequest) {
+		req.offsetFile = path
+	}
+}
+
+//
+// ImProgress sets a function called after every batch is written
+//
+func ImProgress(progress func(ImportProgress)) ImportOption {
+	return func(req *importRequest) {
+		req.progress = progress
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// ImportFile
+//
+
+//
+// ImportFile loads a JSON Lines (plain or DynamoDB typed) or CSV file (with a header line) into the table,
+// using batched writes. Gzip compressed files are detected automatically.
+//
+func (table *TableInstance) ImportFile(path string, options ...ImportOption) (*ImportProgress, error) {
+	req := importRequest{format: IMPORT_JSON}
+
+	for _, option := range options {
+		option(&req)
+	}
+
+	if req.format != IMPORT_JSON && req.format != IMPORT_DYNAMODB_JSON && req.format != IMPORT_CSV {
+		return nil, ERR_INVALID_FORMAT
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r, err := maybeGzip(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var offset int64
+
+	if len(req.offsetFile) > 0 {
+		if offset, err = readOffset(req.offsetFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var next func() (AttributeNameValue, error)
+
+	if req.format == IMPORT_CSV {
+		next, err = csvItems(r, req.types)
+	} else {
+		next, err = jsonItems(r, req.format == IMPORT_DYNAMODB_JSON)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &ImportProgress{}
+	limiter := newRateLimiter(req.rate)
+	batch := make([]WriteRequest, 0, MAX_BATCH_WRITE)
+	keys := map[string]bool{} // keys in the current batch
+
+	// flush writes the batch and records lines (the lines read up to the last item in the batch) in the offset file
+	flush := func(lines int64) error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		consumed, err := table.DB.BatchWriteAll(table.Name, batch)
+		if err != nil {
+			return err
+		}
+
+		progress.Items += int64(len(batch))
+		progress.Consumed += consumed.CapacityUnits
+		batch = batch[:0]
+		keys = map[string]bool{}
+
+		if len(req.offsetFile) > 0 {
+			if err := writeOffset(req.offsetFile, lines); err != nil {
+				return err
+			}
+		}
+
+		if req.progress != nil {
+			req.progress(*progress)
+		}
+
+		limiter.wait(float64(consumed.CapacityUnits))
+		return nil
+	}
+
+	for {
+		item, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return progress, fmt.Errorf("line %d: %v", progress.Lines+1, err)
+		}
+
+		progress.Lines++
+
+		if progress.Lines <= offset || item == nil {
+			continue
+		}
+
+		if req.validate {
+			if err := table.checkKeys(item); err != nil {
+				return progress, fmt.Errorf("line %d: %v", progress.Lines, err)
+			}
+		}
+
+		// a batch can't contain the same key twice: write the previous items first
+		// (the current line is not in the batch, so it must not be recorded in the offset file)
+		if key, ok := table.importKey(item); ok {
+			if keys[key] {
+				if err := flush(progress.Lines - 1); err != nil {
+					return progress, err
+				}
+			}
+
+			keys[key] = true
+		}
+
+		batch = append(batch, PutWriteRequest(item))
+
+		if len(batch) == MAX_BATCH_WRITE {
+			if err := flush(progress.Lines); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	if err := flush(progress.Lines); err != nil {
+		return progress, err
+	}
+
+	if len(req.offsetFile) > 0 {
+		if err := os.Remove(req.offsetFile); err != nil && !os.IsNotExist(err) {
+			return progress, err
+		}
+	}
+
+	return progress, nil
+}
+
+//
+// checkKeys verifies that the item contains the table keys with the correct type
+//
+func (table *TableInstance) checkKeys(item AttributeNameValue) error {
+	for _, key := range table.Keys {
+		if key == nil {
+			continue
+		}
+
+		v := item[key.AttributeName]
+		if len(v) > 1 {
+			return fmt.Errorf("%v: %v should be of type %v", ERR_INVALID_KEY, key.AttributeName, key.AttributeType)
+		}
+
+		if err := checkKeyValue(key, decodeTyped(v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// importKey returns the primary key of the item as a string, or false if the item doesn't have a valid key
+//
+func (table *TableInstance) importKey(item AttributeNameValue) (string, bool) {
+	if table.HashKey() == nil {
+		return "", false
+	}
+
+	hashKey, rangeKey, err := table.keyValues(typedItem(item))
+	if err != nil {
+		return "", false
+	}
+
+	return table.itemCacheKey(hashKey, rangeKey), true
+}
+
+// maybeGzip returns a reader that decompresses the input if it's gzip compressed
+func maybeGzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
+
+func readOffset(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func writeOffset(path string, offset int64) error {
+	return ioutil.WriteFile(path, []byte(strconv.FormatInt(offset, 10)+"\n"), 0644)
+}
+
+//
+// jsonItems returns a function that reads one item per line (nil for empty lines)
+//
+func jsonItems(r io.Reader, typed bool) (func() (AttributeNameValue, error), error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+
+	return func() (AttributeNameValue, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, io.EOF
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			return nil, nil
+		}
+
+		if typed {
+			var item AttributeNameValue
+			if err := json.Unmarshal(line, &item); err != nil {
+				return nil, err
+			}
+
+			return item, nil
+		}
+
+		var item map[string]interface{}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+
+		return EncodeItem(item), nil
+	}, nil
+}
+
+//
+// csvItems returns a function that reads one item per CSV record, using the first record as header
+//
+func csvItems(r io.Reader, types map[string]string) (func() (AttributeNameValue, error), error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (AttributeNameValue, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		item := AttributeNameValue{}
+
+		for i, value := range record {
+			if i >= len(header) || len(value) == 0 {
+				continue
+			}
+
+			name := header[i]
+
+			v, err := csvValue(value, types[name])
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", name, err)
+			}
+
+			item[name] = v
+		}
+
+		return item, nil
+	}, nil
+}
+
+func csvValue(value, typ string) (AttributeValue, error) {
+	switch typ {
+	case "", STRING_ATTRIBUTE:
+		return AttributeValue{STRING_ATTRIBUTE: value}, nil
+
+	case NUMBER_ATTRIBUTE:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, err
+		}
+
+		return AttributeValue{NUMBER_ATTRIBUTE: value}, nil
+
+	case BOOLEAN_ATTRIBUTE:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return AttributeValue{BOOLEAN_ATTRIBUTE: b}, nil
+
+	case LIST_ATTRIBUTE, MAP_ATTRIBUTE:
+		var v interface{}
+
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		return EncodeValue(v), nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %v", typ)
+}
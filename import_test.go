@@ -0,0 +1,156 @@
+package dynago
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+//
+// testBatchTable returns a table backed by a middleware that stores the items written by BatchWriteItem
+// (by "id") and describes the table. The BatchWriteItem call numbered failAt (starting from 1) fails.
+//
+func testBatchTable(items map[string]AttributeNameValue, failAt int) *TableInstance {
+	var lock sync.Mutex
+	calls := 0
+
+	db := NewDBClient()
+	db.SetRegionAndURL("local", "http://localhost:8000")
+	db.Use(func(next QueryFunc) QueryFunc {
+		return func(action string, input, output interface{}) error {
+			if action == "DescribeTable" {
+				output.(*DescribeTableResult).Table = TableDescription{
+					TableName:            "test",
+					KeySchema:            []KeySchemaElement{{AttributeName: "id", KeyType: HASH_KEY_TYPE}},
+					AttributeDefinitions: []AttributeDefinition{{AttributeName: "id", AttributeType: STRING_ATTRIBUTE}},
+				}
+
+				return nil
+			}
+
+			if action != "BatchWriteItem" {
+				return errors.New("unexpected action " + action)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if calls++; calls == failAt {
+				return errors.New("write failed")
+			}
+
+			for _, reqs := range input.(*BatchWriteItemRequest).RequestItems {
+				seen := map[string]bool{}
+
+				for _, req := range reqs {
+					id, _ := req.PutRequest.Item["id"][STRING_ATTRIBUTE].(string)
+					if seen[id] {
+						return errors.New("ValidationException: duplicate key " + id)
+					}
+
+					seen[id] = true
+					items[id] = req.PutRequest.Item
+				}
+			}
+
+			return nil
+		}
+	})
+
+	return &TableInstance{
+		DB:   db,
+		Name: "test",
+		Keys: map[string]*AttributeDefinition{HASH_KEY_TYPE: {AttributeName: "id", AttributeType: STRING_ATTRIBUTE}},
+	}
+}
+
+func TestImportDuplicateKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "items.json")
+	data := `{"id": "a", "v": 1}
+{"id": "b", "v": 1}
+{"id": "a", "v": 2}
+{"id": "c", "v": 1}
+`
+
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items := map[string]AttributeNameValue{}
+
+	progress, err := testBatchTable(items, 0).ImportFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Items != 4 || len(items) != 3 {
+		t.Fatalf("items written: %v, stored: %v", progress.Items, len(items))
+	}
+
+	if v := items["a"]["v"][NUMBER_ATTRIBUTE]; v != "2" {
+		t.Errorf("a: got v=%v, want 2", v)
+	}
+}
+
+func TestImportResumeAfterDuplicateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "items.json")
+	offsetFile := filepath.Join(dir, "offset")
+	data := `{"id": "a", "v": 1}
+{"id": "b", "v": 1}
+{"id": "a", "v": 2}
+{"id": "c", "v": 1}
+`
+
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items := map[string]AttributeNameValue{}
+
+	// the duplicate key flushes the first two lines, then the final flush fails
+	if _, err := testBatchTable(items, 2).ImportFile(path, ImOffsetFile(offsetFile)); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if offset, err := readOffset(offsetFile); err != nil || offset != 2 {
+		t.Fatalf("offset: got %v (%v), want 2", offset, err)
+	}
+
+	progress, err := testBatchTable(items, 0).ImportFile(path, ImOffsetFile(offsetFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Items != 2 {
+		t.Errorf("resume: got %v items written, want 2", progress.Items)
+	}
+
+	if v := items["a"]["v"][NUMBER_ATTRIBUTE]; v != "2" {
+		t.Errorf("a: got v=%v, want 2", v)
+	}
+
+	if _, ok := items["c"]; !ok {
+		t.Error("c not written")
+	}
+
+	if _, err := os.Stat(offsetFile); !os.IsNotExist(err) {
+		t.Error("offset file not removed")
+	}
+}
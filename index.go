@@ -0,0 +1,359 @@
+package dynago
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ERR_UNKNOWN_INDEX           = errors.New("unknown index")
+	ERR_INVALID_RANGE_CONDITION = errors.New("invalid range key condition")
+)
+
+const (
+	indexHashName   = "#dynagoHash"
+	indexHashValue  = ":dynagoHash"
+	indexRangeName  = "#dynagoRange"
+	indexRangeValue = ":dynagoRange"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Secondary indexes
+//
+
+//
+// IndexDefinition describes a local or global secondary index of a table,
+// with the key attribute types resolved from the table attribute definitions
+//
+type IndexDefinition struct {
+	Name       string
+	Global     bool
+	HashKey    *AttributeDefinition
+	RangeKey   *AttributeDefinition // nil if the index has no range key
+	Projection ProjectionDescription
+}
+
+//
+// HashRange returns true if the index has a range key
+//
+func (index *IndexDefinition) HashRange() bool {
+	return index.RangeKey != nil
+}
+
+//
+// keyNames returns the names of the index key attributes
+//
+func (index *IndexDefinition) keyNames() []string {
+	names := []string{index.HashKey.AttributeName}
+	if index.RangeKey != nil {
+		names = append(names, index.RangeKey.AttributeName)
+	}
+
+	return names
+}
+
+func newIndexDefinition(desc *TableDescription, name string, global bool, schema []KeySchemaElement, projection ProjectionDescription) *IndexDefinition {
+	index := &IndexDefinition{Name: name, Global: global, Projection: projection}
+
+	for _, ks := range schema {
+		attr := desc.getAttribute(ks.AttributeName)
+		if attr == nil {
+			// the attribute type is unknown (i.e. for descriptions built by hand)
+			attr = &AttributeDefinition{AttributeName: ks.AttributeName}
+		}
+
+		switch ks.KeyType {
+		case HASH_KEY_TYPE:
+			index.HashKey = attr
+		case RANGE_KEY_TYPE:
+			index.RangeKey = attr
+		}
+	}
+
+	return index
+}
+
+//
+// indexDefinitions returns the definitions of all the secondary indexes (local first, then global)
+//
+func (desc *TableDescription) indexDefinitions() []*IndexDefinition {
+	var indexes []*IndexDefinition
+
+	if desc == nil {
+		return nil
+	}
+
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		indexes = append(indexes, newIndexDefinition(desc, lsi.IndexName, false, lsi.KeySchema, lsi.Projection))
+	}
+
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		indexes = append(indexes, newIndexDefinition(desc, gsi.IndexName, true, gsi.KeySchema, gsi.Projection))
+	}
+
+	return indexes
+}
+
+//
+// Indexes returns the secondary indexes of the table, as returned by DescribeTable in GetTable
+//
+func (table *TableInstance) Indexes() []*IndexDefinition {
+	return table.indexes
+}
+
+//
+// Index returns the definition of the named secondary index, or nil if the table has no such index
+//
+func (table *TableInstance) Index(name string) *IndexDefinition {
+	for _, index := range table.indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+
+	return nil
+}
+
+//
+// tableIndex returns the base table key schema as an IndexDefinition (with an empty name)
+//
+func (table *TableInstance) tableIndex() *IndexDefinition {
+	return &IndexDefinition{
+		HashKey:    table.HashKey(),
+		RangeKey:   table.RangeKey(),
+		Projection: ProjectionDescription{ProjectionType: PROJECTION_ALL},
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Index queries
+//
+
+type rangeCondition struct {
+	op     string
+	values []interface{}
+}
+
+//
+// QueryIndex creates a query for the items with the specified hash key on the named index,
+// using the index key schema (an empty indexName queries the base table).
+//
+// The key conditions are validated against the index key types and errors are returned by Exec.
+// Use SetRangeCondition to add a condition on the index range key and SetFetchItems
+// to get the full items for indexes that don't project all the attributes.
+//
+func (table *TableInstance) QueryIndex(indexName string, hashKey interface{}) *QueryRequest {
+	query := QueryTable(table)
+
+	index := table.tableIndex()
+	if len(indexName) > 0 {
+		if index = table.Index(indexName); index == nil {
+			query.err = fmt.Errorf("%v: %v", ERR_UNKNOWN_INDEX, indexName)
+			return query
+		}
+
+		query.IndexName = indexName
+	}
+
+	if err := checkKeyValue(index.HashKey, hashKey); err != nil {
+		query.err = err
+		return query
+	}
+
+	query.index = index
+	query.hashKey = hashKey
+	return query
+}
+
+//
+// SetRangeCondition sets the condition on the range key of the index for a query created by QueryIndex.
+//
+// op is one of "EQ", "LT", "LE", "GT", "GE", "BEGINS_WITH" (for string and binary keys) or "BETWEEN" (with two values)
+// and the values should match the type of the index range key.
+//
+func (req *QueryRequest) SetRangeCondition(op string, values ...interface{}) *QueryRequest {
+	if req.err != nil {
+		return req
+	}
+
+	if req.index == nil {
+		req.err = fmt.Errorf("%v: not an index query (use QueryIndex)", ERR_INVALID_RANGE_CONDITION)
+		return req
+	}
+
+	if err := checkRangeCondition(req.index, op, values); err != nil {
+		req.err = err
+		return req
+	}
+
+	req.rangeCond = &rangeCondition{op: op, values: values}
+	return req
+}
+
+//
+// SetFetchItems (for queries created by QueryIndex) gets the full items from the base table
+// when the index projection is KEYS_ONLY or INCLUDE, preserving the index order.
+// The capacity consumed by the extra reads is added to the query consumed capacity.
+//
+func (req *QueryRequest) SetFetchItems(fetch bool) *QueryRequest {
+	req.fetchItems = fetch
+	return req
+}
+
+func checkRangeCondition(index *IndexDefinition, op string, values []interface{}) error {
+	if index.RangeKey == nil {
+		return fmt.Errorf("%v: index %q has no range key", ERR_INVALID_RANGE_CONDITION, index.Name)
+	}
+
+	nvalues := 1
+
+	switch op {
+	case "EQ", "LT", "LE", "GT", "GE":
+
+	case "BETWEEN":
+		nvalues = 2
+
+	case "BEGINS_WITH":
+		if index.RangeKey.AttributeType == NUMBER_ATTRIBUTE {
+			return fmt.Errorf("%v: BEGINS_WITH on numeric key %v", ERR_INVALID_RANGE_CONDITION, index.RangeKey.AttributeName)
+		}
+
+	default:
+		return fmt.Errorf("%v: unsupported operator %v", ERR_INVALID_RANGE_CONDITION, op)
+	}
+
+	if len(values) != nvalues {
+		return fmt.Errorf("%v: %v requires %v value(s)", ERR_INVALID_RANGE_CONDITION, op, nvalues)
+	}
+
+	for _, v := range values {
+		if err := checkKeyValue(index.RangeKey, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// keyConditionExpression returns the key condition for the range key (i.e. "#r BETWEEN :r0 AND :r1")
+// and the values to bind
+//
+func (cond *rangeCondition) keyConditionExpression(key *AttributeDefinition) (string, AttributeNameValue) {
+	values := AttributeNameValue{}
+	names := make([]string, len(cond.values))
+
+	for i, v := range cond.values {
+		names[i] = fmt.Sprintf("%v%v", indexRangeValue, i)
+		values[names[i]] = encodeKeyValue(*key, v)
+	}
+
+	switch cond.op {
+	case "BETWEEN":
+		return indexRangeName + " BETWEEN " + names[0] + " AND " + names[1], values
+
+	case "BEGINS_WITH":
+		return "begins_with(" + indexRangeName + ", " + names[0] + ")", values
+	}
+
+	ops := map[string]string{"EQ": "=", "LT": "<", "LE": "<=", "GT": ">", "GE": ">="}
+	return indexRangeName + " " + ops[cond.op] + " " + names[0], values
+}
+
+//
+// keyQuery returns a copy of the request with the key conditions for the index added
+// to the caller expression attribute names and values
+//
+func (req *QueryRequest) keyQuery() *QueryRequest {
+	query := *req
+	query.index = nil
+
+	names := map[string]string{indexHashName: req.index.HashKey.AttributeName}
+	for k, v := range req.ExpressionAttributeNames {
+		names[k] = v
+	}
+
+	values := AttributeNameValue{indexHashValue: encodeKeyValue(*req.index.HashKey, req.hashKey)}
+	for k, v := range req.ExpressionAttributeValues {
+		values[k] = v
+	}
+
+	cond := indexHashName + " = " + indexHashValue
+
+	if req.rangeCond != nil {
+		rcond, rvalues := req.rangeCond.keyConditionExpression(req.index.RangeKey)
+		names[indexRangeName] = req.index.RangeKey.AttributeName
+		for k, v := range rvalues {
+			values[k] = v
+		}
+
+		cond += " AND " + rcond
+	}
+
+	query.KeyConditionExpression = cond
+	query.ExpressionAttributeNames = names
+	query.ExpressionAttributeValues = values
+	return &query
+}
+
+//
+// execIndex executes a query created by QueryIndex, fetching the full items if requested
+//
+func (req *QueryRequest) execIndex(db *DBClient) ([]Item, AttributeNameValue, ConsumedCapacityDescription, error) {
+	items, last, consumed, err := req.keyQuery().Exec(db)
+	if err != nil || !req.fetchItems || len(items) == 0 {
+		return items, last, consumed, err
+	}
+
+	if req.index.Projection.ProjectionType == PROJECTION_ALL || req.Select == SELECT_COUNT {
+		return items, last, consumed, nil
+	}
+
+	items, units, err := req.table.fetchItems(db, items, req.ConsistentRead && !req.index.Global)
+	consumed.Add(units)
+	return items, last, consumed, err
+}
+
+//
+// fetchItems gets the full items for the keys in the (partial) items, in the same order.
+// Items that were deleted in the meantime are skipped.
+//
+func (table *TableInstance) fetchItems(db *DBClient, items []Item, consistent bool) ([]Item, ConsumedCapacityDescription, error) {
+	keys := make([]AttributeNameValue, len(items))
+
+	for i, item := range items {
+		key, err := table.KeyOf(item)
+		if err != nil {
+			return nil, ConsumedCapacityDescription{}, err
+		}
+
+		keys[i] = EncodeItem(key)
+	}
+
+	full, consumed, err := db.BatchGetAll(table.Name, keys, consistent)
+	if err != nil {
+		return nil, consumed, err
+	}
+
+	byKey := make(map[string]Item, len(full))
+	for _, item := range full {
+		hashKey, rangeKey, err := table.keyValues(item)
+		if err != nil {
+			return nil, consumed, err
+		}
+
+		byKey[table.itemCacheKey(hashKey, rangeKey)] = item
+	}
+
+	res := make([]Item, 0, len(items))
+	for _, item := range items {
+		hashKey, rangeKey, _ := table.keyValues(item)
+		if full, ok := byKey[table.itemCacheKey(hashKey, rangeKey)]; ok {
+			res = append(res, full)
+		}
+	}
+
+	return res, consumed, nil
+}
@@ -16,7 +16,7 @@ var (
 	RETURN_CONSUMED = map[bool]string{true: "TOTAL", false: "NONE"}
 
 	RETURN_TOTAL_CONSUMED = "TOTAL"
-	RETURN_INDEX_CONSUMED = "INDEXED"
+	RETURN_INDEX_CONSUMED = "INDEXES"
 
 	RETURN_METRICS = map[bool]string{true: "SIZE", false: "NONE"}
 
@@ -27,9 +27,72 @@ var (
 	RETURN_UPDATED_NEW = "UPDATED_NEW"
 )
 
+type Capacity struct {
+	CapacityUnits      float32
+	ReadCapacityUnits  float32 `json:",omitempty"`
+	WriteCapacityUnits float32 `json:",omitempty"`
+}
+
+func (c Capacity) plus(o Capacity) Capacity {
+	return Capacity{
+		CapacityUnits:      c.CapacityUnits + o.CapacityUnits,
+		ReadCapacityUnits:  c.ReadCapacityUnits + o.ReadCapacityUnits,
+		WriteCapacityUnits: c.WriteCapacityUnits + o.WriteCapacityUnits,
+	}
+}
+
+//
+// ConsumedCapacityDescription is the capacity consumed by a request.
+// The Table and index details are only returned with ReturnConsumedCapacity set to RETURN_INDEX_CONSUMED (INDEXES).
+//
 type ConsumedCapacityDescription struct {
-	CapacityUnits float32
-	TableName     string
+	CapacityUnits      float32
+	ReadCapacityUnits  float32 `json:",omitempty"`
+	WriteCapacityUnits float32 `json:",omitempty"`
+	TableName          string
+
+	Table                  *Capacity           `json:",omitempty"`
+	LocalSecondaryIndexes  map[string]Capacity `json:",omitempty"`
+	GlobalSecondaryIndexes map[string]Capacity `json:",omitempty"`
+}
+
+//
+// Add adds the capacity consumed by another request (i.e. for paginated or batch requests).
+// TableName is cleared if the requests are for different tables.
+//
+func (c *ConsumedCapacityDescription) Add(o ConsumedCapacityDescription) {
+	if c.CapacityUnits == 0 && len(c.TableName) == 0 {
+		c.TableName = o.TableName
+	} else if c.TableName != o.TableName {
+		c.TableName = ""
+	}
+
+	c.CapacityUnits += o.CapacityUnits
+	c.ReadCapacityUnits += o.ReadCapacityUnits
+	c.WriteCapacityUnits += o.WriteCapacityUnits
+
+	if o.Table != nil {
+		if c.Table == nil {
+			c.Table = &Capacity{}
+		}
+
+		*c.Table = c.Table.plus(*o.Table)
+	}
+
+	c.LocalSecondaryIndexes = addIndexCapacity(c.LocalSecondaryIndexes, o.LocalSecondaryIndexes)
+	c.GlobalSecondaryIndexes = addIndexCapacity(c.GlobalSecondaryIndexes, o.GlobalSecondaryIndexes)
+}
+
+func addIndexCapacity(to, from map[string]Capacity) map[string]Capacity {
+	for name, c := range from {
+		if to == nil {
+			to = map[string]Capacity{}
+		}
+
+		to[name] = to[name].plus(c)
+	}
+
+	return to
 }
 
 type KeyValue struct {
@@ -99,9 +162,13 @@ type ItemRequest struct {
 	ExpressionAttributeNames  map[string]string  `json:",omitempty"`
 	ExpressionAttributeValues AttributeNameValue `json:",omitempty"`
 
-	ReturnConsumedCapacity      string `json:",omitempty"` // INDEXED | TOTAL | NONE
+	ReturnConsumedCapacity      string `json:",omitempty"` // INDEXES | TOTAL | NONE
 	ReturnItemCollectionMetrics string `json:",omitempty"` // SIZE | NONE
 	ReturnValues                string `json:",omitempty"` // NONE | ALL_OLD | UPDATED_OLD | ALL_NEW | UPDATED_NEW
+
+	expectedVersion interface{} // UpdateItem/DeleteItem on versioned tables
+	maxItemSize     int         // see MaxItemSize
+	validateKeys    bool        // see ValidateKeys
 }
 
 type ItemOption func(*ItemRequest)
@@ -147,7 +214,7 @@ func ReturnValues(target string) ItemOption {
 // PutItem
 //
 
-func (db *DBClient) PutItem(tableName string, item Item, options ...ItemOption) (*Item, float32, error) {
+func (db *DBClient) PutItem(tableName string, item Item, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
 	var req = ItemRequest{TableName: tableName, Item: &item}
 	var res ItemResult
 
@@ -155,10 +222,14 @@ func (db *DBClient) PutItem(tableName string, item Item, options ...ItemOption)
 		option(&req)
 	}
 
+	if err := req.checkSize(); err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
 	if err := db.Query("PutItem", &req).Decode(&res); err != nil {
-		return nil, 0.0, err
+		return nil, ConsumedCapacityDescription{}, err
 	} else {
-		return &res.Attributes, res.ConsumedCapacity.CapacityUnits, err
+		return &res.Attributes, res.ConsumedCapacity, err
 	}
 }
 
@@ -167,27 +238,31 @@ func (db *DBClient) PutItem(tableName string, item Item, options ...ItemOption)
 // UpdateItem
 //
 
-func (db *DBClient) UpdateItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, updates string, options ...ItemOption) (*Item, float32, error) {
+func (db *DBClient) UpdateItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, updates string, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
 	var req = ItemRequest{TableName: tableName, UpdateExpression: updates}
 	var res ItemResult
 
-	req.Key = EncodeAttribute(hashKey.Key, hashKey.Value)
+	req.Key = AttributeNameValue{hashKey.Key.AttributeName: encodeKeyValue(hashKey.Key, hashKey.Value)}
 	if rangeKey != nil {
-		req.Key[rangeKey.Key.AttributeName] = EncodeAttributeValue(rangeKey.Key, rangeKey.Value)
+		req.Key[rangeKey.Key.AttributeName] = encodeKeyValue(rangeKey.Key, rangeKey.Value)
 	}
 
 	if rangeKey != nil {
-		req.Key[rangeKey.Key.AttributeName] = EncodeAttributeValue(rangeKey.Key, rangeKey.Value)
+		req.Key[rangeKey.Key.AttributeName] = encodeKeyValue(rangeKey.Key, rangeKey.Value)
 	}
 
 	for _, option := range options {
 		option(&req)
 	}
 
+	if err := req.checkSize(); err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
 	if err := db.Query("UpdateItem", &req).Decode(&res); err != nil {
-		return nil, 0.0, err
+		return nil, ConsumedCapacityDescription{}, err
 	} else {
-		return &res.Attributes, res.ConsumedCapacity.CapacityUnits, err
+		return &res.Attributes, res.ConsumedCapacity, err
 	}
 }
 
@@ -196,13 +271,13 @@ func (db *DBClient) UpdateItem(tableName string, hashKey *KeyValue, rangeKey *Ke
 // DeleteItem
 //
 
-func (db *DBClient) DeleteItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, options ...ItemOption) (*Item, float32, error) {
+func (db *DBClient) DeleteItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
 	var req = ItemRequest{TableName: tableName}
 	var res ItemResult
 
-	req.Key = EncodeAttribute(hashKey.Key, hashKey.Value)
+	req.Key = AttributeNameValue{hashKey.Key.AttributeName: encodeKeyValue(hashKey.Key, hashKey.Value)}
 	if rangeKey != nil {
-		req.Key[rangeKey.Key.AttributeName] = EncodeAttributeValue(rangeKey.Key, rangeKey.Value)
+		req.Key[rangeKey.Key.AttributeName] = encodeKeyValue(rangeKey.Key, rangeKey.Value)
 	}
 
 	for _, option := range options {
@@ -210,9 +285,9 @@ func (db *DBClient) DeleteItem(tableName string, hashKey *KeyValue, rangeKey *Ke
 	}
 
 	if err := db.Query("DeleteItem", &req).Decode(&res); err != nil {
-		return nil, 0.0, err
+		return nil, ConsumedCapacityDescription{}, err
 	} else {
-		return &res.Attributes, res.ConsumedCapacity.CapacityUnits, err
+		return &res.Attributes, res.ConsumedCapacity, err
 	}
 }
 
@@ -235,25 +310,41 @@ type GetItemResult struct {
 	Item Item
 }
 
-func (db *DBClient) GetItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, attributes []string, consistent bool, consumed bool) (map[string]interface{}, float32, error) {
+type GetItemOption func(*GetItemRequest)
+
+//
+// GiReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE),
+// overriding the consumed flag
+//
+func GiReturnConsumed(target string) GetItemOption {
+	return func(req *GetItemRequest) {
+		req.ReturnConsumedCapacity = target
+	}
+}
+
+func (db *DBClient) GetItem(tableName string, hashKey *KeyValue, rangeKey *KeyValue, attributes []string, consistent bool, consumed bool, options ...GetItemOption) (map[string]interface{}, ConsumedCapacityDescription, error) {
 
 	req := GetItemRequest{TableName: tableName, AttributesToGet: attributes, ConsistentRead: consistent, ReturnConsumedCapacity: RETURN_CONSUMED[consumed]}
-	req.Key = EncodeAttribute(hashKey.Key, hashKey.Value)
+	req.Key = AttributeNameValue{hashKey.Key.AttributeName: encodeKeyValue(hashKey.Key, hashKey.Value)}
 	if rangeKey != nil {
-		req.Key[rangeKey.Key.AttributeName] = EncodeAttributeValue(rangeKey.Key, rangeKey.Value)
+		req.Key[rangeKey.Key.AttributeName] = encodeKeyValue(rangeKey.Key, rangeKey.Value)
+	}
+
+	for _, option := range options {
+		option(&req)
 	}
 
 	var res GetItemResult
 
 	if err := db.Query("GetItem", req).Decode(&res); err != nil {
-		return nil, 0.0, err
+		return nil, ConsumedCapacityDescription{}, err
 	}
 
 	if len(res.Item) == 0 {
-		return nil, res.ConsumedCapacity.CapacityUnits, nil
+		return nil, res.ConsumedCapacity, nil
 	}
 
-	return res.Item, res.ConsumedCapacity.CapacityUnits, nil
+	return res.Item, res.ConsumedCapacity, nil
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -265,6 +356,7 @@ type QueryRequest struct {
 	TableName        string
 	AttributesToGet  []string `json:",omitempty"` // deprecated
 	ScanIndexForward bool
+	ConsistentRead   bool `json:",omitempty"`
 
 	ExclusiveStartKey AttributeNameValue   `json:",omitempty"`
 	KeyConditions     map[string]Condition `json:",omitempty"` // deprecated
@@ -281,6 +373,13 @@ type QueryRequest struct {
 	ReturnConsumedCapacity string `json:",omitempty"`
 
 	table *TableInstance
+
+	// see QueryIndex
+	index      *IndexDefinition
+	hashKey    interface{}
+	rangeCond  *rangeCondition
+	fetchItems bool
+	err        error
 }
 
 type QueryResult struct {
@@ -291,6 +390,15 @@ type QueryResult struct {
 	ScannedCount     int
 }
 
+// RawQueryResult is like QueryResult, with the items not decoded
+type RawQueryResult struct {
+	Items            []AttributeNameValue
+	ConsumedCapacity ConsumedCapacityDescription
+	LastEvaluatedKey AttributeNameValue
+	Count            int
+	ScannedCount     int
+}
+
 func QueryTable(table *TableInstance) *QueryRequest {
 	return &QueryRequest{TableName: table.Name, ScanIndexForward: true, table: table}
 }
@@ -365,23 +473,48 @@ func (req *QueryRequest) SetSelect(selectValue string) *QueryRequest {
 	return req
 }
 
+func (req *QueryRequest) SetConsistentRead(consistent bool) *QueryRequest {
+	req.ConsistentRead = consistent
+	return req
+}
+
 func (req *QueryRequest) SetConsumed(consumed bool) *QueryRequest {
 	req.ReturnConsumedCapacity = RETURN_CONSUMED[consumed]
 	return req
 }
 
-func (req *QueryRequest) Exec(db *DBClient) ([]Item, AttributeNameValue, float32, error) {
+//
+// SetReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE)
+//
+func (req *QueryRequest) SetReturnConsumed(target string) *QueryRequest {
+	req.ReturnConsumedCapacity = target
+	return req
+}
+
+func (req *QueryRequest) Exec(db *DBClient) ([]Item, AttributeNameValue, ConsumedCapacityDescription, error) {
+	if req.err != nil {
+		return nil, nil, ConsumedCapacityDescription{}, req.err
+	}
+
 	if db == nil && req.table != nil {
 		db = req.table.DB
 	}
 
+	if req.index != nil {
+		return req.execIndex(db)
+	}
+
+	if req.table != nil && req.table.cache != nil && req.table.DB == db {
+		return req.cachedExec(db, req.table.cache)
+	}
+
 	var res QueryResult
 
 	if err := db.Query("Query", req).Decode(&res); err != nil {
-		return nil, nil, 0.0, err
+		return nil, nil, ConsumedCapacityDescription{}, err
 	}
 
-	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity.CapacityUnits, nil
+	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity, nil
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -462,21 +595,42 @@ func (req *ScanRequest) SetConsumed(consumed bool) *ScanRequest {
 	return req
 }
 
-func (req *ScanRequest) Exec(db *DBClient) ([]Item, AttributeNameValue, float32, error) {
+//
+// SetReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE)
+//
+func (req *ScanRequest) SetReturnConsumed(target string) *ScanRequest {
+	req.ReturnConsumedCapacity = target
+	return req
+}
+
+func (req *ScanRequest) Exec(db *DBClient) ([]Item, AttributeNameValue, ConsumedCapacityDescription, error) {
 	var res QueryResult
 
 	if err := db.Query("Scan", req).Decode(&res); err != nil {
-		return nil, nil, 0.0, err
+		return nil, nil, ConsumedCapacityDescription{}, err
+	}
+
+	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity, nil
+}
+
+//
+// ExecRaw is like Exec but returns the items as DynamoDB typed values (not decoded)
+//
+func (req *ScanRequest) ExecRaw(db *DBClient) ([]AttributeNameValue, AttributeNameValue, ConsumedCapacityDescription, error) {
+	var res RawQueryResult
+
+	if err := db.Query("Scan", req).Decode(&res); err != nil {
+		return nil, nil, ConsumedCapacityDescription{}, err
 	}
 
-	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity.CapacityUnits, nil
+	return res.Items, res.LastEvaluatedKey, res.ConsumedCapacity, nil
 }
 
-func (req *ScanRequest) Count(db *DBClient) (count int, scount int, consumed float32, err error) {
+func (req *ScanRequest) Count(db *DBClient) (count int, scount int, consumed ConsumedCapacityDescription, err error) {
 	return req.CountWithDelay(db, 0)
 }
 
-func (req *ScanRequest) CountWithDelay(db *DBClient, delay time.Duration) (count int, scount int, consumed float32, err error) {
+func (req *ScanRequest) CountWithDelay(db *DBClient, delay time.Duration) (count int, scount int, consumed ConsumedCapacityDescription, err error) {
 	var res QueryResult
 
 	creq := *req
@@ -491,7 +645,7 @@ func (req *ScanRequest) CountWithDelay(db *DBClient, delay time.Duration) (count
 
 		count += res.Count
 		scount += res.ScannedCount
-		consumed += res.ConsumedCapacity.CapacityUnits
+		consumed.Add(res.ConsumedCapacity)
 
 		if res.LastEvaluatedKey == nil {
 			break
@@ -0,0 +1,453 @@
+package dynago
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_ITEM_SIZE = 400 * 1024 // maximum size of a DynamoDB item, in bytes
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Item size
+//
+
+//
+// ItemSize returns the size of the item as computed by DynamoDB: the sum of the lengths
+// of the attribute names and of the attribute values, where
+//
+// - strings and binary values count their length in bytes (UTF-8 for strings)
+//
+// - numbers count 1 byte every 2 significant digits, plus 1
+//
+// - booleans and nulls count 1 byte
+//
+// - lists and maps count 3 bytes, plus 1 byte and the size (and name, for maps) of each element
+//
+// - sets count the size of their elements
+//
+// The size of numbers and nested values is an approximation (DynamoDB doesn't document the exact encoding).
+//
+func ItemSize(item Item) int {
+	size := 0
+
+	for name, value := range item {
+		if value != nil {
+			size += len(name) + valueSize(value)
+		}
+	}
+
+	return size
+}
+
+//
+// AttributesSize is like ItemSize, for an encoded item (i.e. the items in a WriteRequest)
+//
+func AttributesSize(item AttributeNameValue) int {
+	size := 0
+
+	for name, value := range item {
+		size += len(name) + AttributeValueSize(value)
+	}
+
+	return size
+}
+
+//
+// valueSize returns the size of a decoded value (see ItemSize).
+// Values of unknown types count 0 bytes.
+//
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil, bool:
+		return 1
+
+	case string:
+		return len(v)
+
+	case []byte:
+		return len(v)
+
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return numberSize(fmt.Sprint(v))
+
+	case float32:
+		return numberSize(strconv.FormatFloat(float64(v), 'f', -1, 32))
+
+	case float64:
+		return numberSize(strconv.FormatFloat(v, 'f', -1, 64))
+
+	case json.Number:
+		return numberSize(string(v))
+
+	case []string:
+		return stringSetSize(v)
+
+	case stringSet:
+		return stringSetSize(v)
+
+	case [][]byte:
+		return binarySetSize(v)
+
+	case binarySet:
+		return binarySetSize(v)
+
+	case numberSet:
+		size := 0
+		for _, n := range v {
+			size += numberSize(string(n))
+		}
+		return size
+
+	case []json.Number, []float32, []float64, []int, []int64:
+		size := 0
+		for _, n := range setOrList(v) {
+			size += valueSize(n)
+		}
+		return size
+
+	case []interface{}:
+		size := 3
+		for _, e := range v {
+			size += 1 + valueSize(e)
+		}
+		return size
+
+	case map[string]interface{}:
+		return mapSize(v)
+
+	case Item:
+		return mapSize(v)
+	}
+
+	return 0
+}
+
+func stringSetSize(set []string) int {
+	size := 0
+	for _, s := range set {
+		size += len(s)
+	}
+
+	return size
+}
+
+func binarySetSize(set [][]byte) int {
+	size := 0
+	for _, b := range set {
+		size += len(b)
+	}
+
+	return size
+}
+
+func mapSize(m map[string]interface{}) int {
+	size := 3
+	for k, e := range m {
+		size += len(k) + 1 + valueSize(e)
+	}
+
+	return size
+}
+
+//
+// AttributeValueSize returns the size of an encoded attribute value (see ItemSize)
+//
+func AttributeValueSize(av AttributeValue) int {
+	size := 0
+
+	for t, v := range av {
+		switch t {
+		case STRING_ATTRIBUTE:
+			s, _ := v.(string)
+			size += len(s)
+
+		case NUMBER_ATTRIBUTE:
+			s, _ := v.(string)
+			size += numberSize(s)
+
+		case BINARY_ATTRIBUTE:
+			size += binarySize(v)
+
+		case BOOLEAN_ATTRIBUTE, NULL_ATTRIBUTE:
+			size += 1
+
+		case STRING_SET_ATTRIBUTE, NUMBER_SET_ATTRIBUTE, BINARY_SET_ATTRIBUTE:
+			for _, e := range setElements(v) {
+				switch t {
+				case STRING_SET_ATTRIBUTE:
+					s, _ := e.(string)
+					size += len(s)
+
+				case NUMBER_SET_ATTRIBUTE:
+					s, _ := e.(string)
+					size += numberSize(s)
+
+				default:
+					size += binarySize(e)
+				}
+			}
+
+		case LIST_ATTRIBUTE:
+			size += 3
+
+			switch l := v.(type) {
+			case []AttributeValue:
+				for _, e := range l {
+					size += 1 + AttributeValueSize(e)
+				}
+
+			case []interface{}: // from JSON
+				for _, e := range l {
+					m, _ := e.(map[string]interface{})
+					size += 1 + AttributeValueSize(m)
+				}
+			}
+
+		case MAP_ATTRIBUTE:
+			size += 3
+
+			switch m := v.(type) {
+			case map[string]AttributeValue:
+				for k, e := range m {
+					size += len(k) + 1 + AttributeValueSize(e)
+				}
+
+			case map[string]interface{}: // from JSON
+				for k, e := range m {
+					mv, _ := e.(map[string]interface{})
+					size += len(k) + 1 + AttributeValueSize(mv)
+				}
+			}
+		}
+	}
+
+	return size
+}
+
+func setElements(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+
+	case []string:
+		l := make([]interface{}, len(v))
+		for i, s := range v {
+			l[i] = s
+		}
+		return l
+
+	case [][]byte:
+		l := make([]interface{}, len(v))
+		for i, b := range v {
+			l[i] = b
+		}
+		return l
+	}
+
+	return nil
+}
+
+func binarySize(v interface{}) int {
+	switch v := v.(type) {
+	case []byte:
+		return len(v)
+
+	case string: // base64 encoded
+		if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+			return len(b)
+		}
+
+		return len(v)
+	}
+
+	return 0
+}
+
+//
+// numberSize returns the size of a number: 1 byte every 2 significant digits, plus 1
+//
+func numberSize(n string) int {
+	n = strings.TrimLeft(n, "+-")
+
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		n = n[:i]
+	}
+
+	digits := strings.Replace(n, ".", "", 1)
+	digits = strings.TrimLeft(digits, "0")
+	digits = strings.TrimRight(digits, "0")
+
+	if len(digits) == 0 {
+		return 1
+	}
+
+	return (len(digits)+1)/2 + 1
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Item size check
+//
+
+//
+// ErrItemTooLarge is returned when an item is larger than the configured limit (see MaxItemSize)
+//
+type ErrItemTooLarge struct {
+	Size    int
+	Limit   int
+	Largest []AttributeSize // the largest attributes, in decreasing size
+}
+
+type AttributeSize struct {
+	Name string
+	Size int
+}
+
+func (err *ErrItemTooLarge) Error() string {
+	largest := make([]string, len(err.Largest))
+	for i, a := range err.Largest {
+		largest[i] = fmt.Sprintf("%v (%v bytes)", a.Name, a.Size)
+	}
+
+	return fmt.Sprintf("item size %v bytes exceeds the limit of %v bytes; largest attributes: %v",
+		err.Size, err.Limit, strings.Join(largest, ", "))
+}
+
+//
+// checkItemSize returns an ErrItemTooLarge if the attributes are larger than limit
+//
+func checkItemSize(sizes map[string]int, limit int) error {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	if total <= limit {
+		return nil
+	}
+
+	largest := make([]AttributeSize, 0, len(sizes))
+	for name, size := range sizes {
+		largest = append(largest, AttributeSize{Name: name, Size: size})
+	}
+
+	sort.Slice(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+
+	if len(largest) > 3 {
+		largest = largest[:3]
+	}
+
+	return &ErrItemTooLarge{Size: total, Limit: limit, Largest: largest}
+}
+
+func itemSizes(item Item) map[string]int {
+	sizes := map[string]int{}
+
+	for name, value := range item {
+		if value != nil {
+			sizes[name] = len(name) + valueSize(value)
+		}
+	}
+
+	return sizes
+}
+
+func attributesSizes(item AttributeNameValue) map[string]int {
+	sizes := map[string]int{}
+
+	for name, value := range item {
+		sizes[name] = len(name) + AttributeValueSize(value)
+	}
+
+	return sizes
+}
+
+//
+// MaxItemSize rejects items larger than limit bytes (MAX_ITEM_SIZE if limit is 0) before sending the request.
+//
+// For PutItem the size of the item is checked. For UpdateItem the size of the resulting item is not known,
+// so only the size of the key and of the expression attribute values is checked.
+//
+func MaxItemSize(limit int) ItemOption {
+	if limit <= 0 {
+		limit = MAX_ITEM_SIZE
+	}
+
+	return func(req *ItemRequest) {
+		req.maxItemSize = limit
+	}
+}
+
+func (req *ItemRequest) checkSize() error {
+	if req.maxItemSize == 0 {
+		return nil
+	}
+
+	if req.Item != nil {
+		return checkItemSize(itemSizes(*req.Item), req.maxItemSize)
+	}
+
+	sizes := attributesSizes(req.Key)
+	for name, size := range attributesSizes(req.ExpressionAttributeValues) {
+		sizes[name] = size - len(name) // placeholders are not stored
+	}
+
+	return checkItemSize(sizes, req.maxItemSize)
+}
+
+//
+// BatchWriteOption configures BatchWriteItem and BatchWriteAll
+//
+type BatchWriteOption func(*batchWriteOptions)
+
+type batchWriteOptions struct {
+	maxItemSize    int
+	returnConsumed string
+}
+
+//
+// BwMaxItemSize rejects batches with put requests for items larger than limit bytes
+// (MAX_ITEM_SIZE if limit is 0), before sending any request
+//
+func BwMaxItemSize(limit int) BatchWriteOption {
+	if limit <= 0 {
+		limit = MAX_ITEM_SIZE
+	}
+
+	return func(opts *batchWriteOptions) {
+		opts.maxItemSize = limit
+	}
+}
+
+func checkBatchSizes(requests []WriteRequest, options []BatchWriteOption) error {
+	var opts batchWriteOptions
+
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if opts.maxItemSize == 0 {
+		return nil
+	}
+
+	for i, req := range requests {
+		if req.PutRequest == nil {
+			continue
+		}
+
+		if err := checkItemSize(attributesSizes(req.PutRequest.Item), opts.maxItemSize); err != nil {
+			return fmt.Errorf("request %v: %v", i, err)
+		}
+	}
+
+	return nil
+}
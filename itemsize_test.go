@@ -0,0 +1,82 @@
+package dynago
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestItemSizeTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		size  int
+	}{
+		{"string", "abcd", 4},
+		{"utf8", "àè", 4},
+		{"int", 12345, 4},
+		{"float", 1.5, 2},
+		{"float32", float32(0.25), 2},
+		{"json.Number", json.Number("-123.4500"), 4},
+		{"bool", true, 1},
+		{"binary", []byte("abcde"), 5},
+
+		{"string set", []string{"aaaa", "bbbb"}, 8},
+		{"number set", []float32{1, 22, 333}, 2 + 2 + 3},
+		{"int number set", []int{1, 22}, 2 + 2},
+		{"binary set", [][]byte{[]byte("ab"), []byte("cde")}, 5},
+
+		{"list", []interface{}{"ab", 1, nil}, 3 + (1 + 2) + (1 + 2) + (1 + 1)},
+		{"map", map[string]interface{}{"k": "v", "b": []byte("xyz")}, 3 + (1 + 1 + 1) + (1 + 1 + 3)},
+		{"nested set", map[string]interface{}{"s": []string{"abc"}}, 3 + 1 + 1 + 3},
+		{"nested list", []interface{}{[]interface{}{[]byte("ab")}}, 3 + 1 + 3 + 1 + 2},
+	}
+
+	for _, test := range tests {
+		if size := ItemSize(Item{"a": test.value}); size != 1+test.size {
+			t.Errorf("%v: got %v, want %v", test.name, size, 1+test.size)
+		}
+	}
+}
+
+func TestItemSizeEncoded(t *testing.T) {
+	item := Item{
+		"s":  "abcd",
+		"n":  12345,
+		"b":  []byte("abcde"),
+		"ss": []string{"aaaa", "bbbb"},
+		"bs": [][]byte{[]byte("ab"), []byte("cde")},
+		"l":  []interface{}{"ab", 1},
+		"m":  map[string]interface{}{"k": "v", "b": []byte("xyz")},
+	}
+
+	encoded := AttributeNameValue{
+		"s":  {STRING_ATTRIBUTE: "abcd"},
+		"n":  {NUMBER_ATTRIBUTE: "12345"},
+		"b":  {BINARY_ATTRIBUTE: []byte("abcde")},
+		"ss": {STRING_SET_ATTRIBUTE: []string{"aaaa", "bbbb"}},
+		"bs": {BINARY_SET_ATTRIBUTE: [][]byte{[]byte("ab"), []byte("cde")}},
+		"l":  {LIST_ATTRIBUTE: []AttributeValue{{STRING_ATTRIBUTE: "ab"}, {NUMBER_ATTRIBUTE: "1"}}},
+		"m":  {MAP_ATTRIBUTE: map[string]AttributeValue{"k": {STRING_ATTRIBUTE: "v"}, "b": {BINARY_ATTRIBUTE: []byte("xyz")}}},
+	}
+
+	if size, esize := ItemSize(item), AttributesSize(encoded); size != esize {
+		t.Errorf("decoded size %v, encoded size %v", size, esize)
+	}
+}
+
+func TestMaxItemSize(t *testing.T) {
+	item := Item{"id": "x", "data": strings.Repeat("a", MAX_ITEM_SIZE)}
+	req := ItemRequest{Item: &item}
+	MaxItemSize(0)(&req)
+
+	err := req.checkSize()
+	if e, ok := err.(*ErrItemTooLarge); !ok || e.Largest[0].Name != "data" {
+		t.Fatalf("expected ErrItemTooLarge, got %v", err)
+	}
+
+	item = Item{"id": "x", "data": [][]byte{[]byte(strings.Repeat("a", MAX_ITEM_SIZE))}}
+	if err := req.checkSize(); err == nil {
+		t.Fatal("expected error for a large binary set")
+	}
+}
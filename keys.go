@@ -0,0 +1,154 @@
+package dynago
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Key helpers
+//
+
+//
+// checkKeyValue verifies that value is a valid Go value for the key attribute
+//
+func checkKeyValue(key *AttributeDefinition, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("%v: %v missing", ERR_INVALID_KEY, key.AttributeName)
+	}
+
+	var ok bool
+
+	switch key.AttributeType {
+	case STRING_ATTRIBUTE:
+		var s string
+		s, ok = value.(string)
+		ok = ok && len(s) > 0
+
+	case NUMBER_ATTRIBUTE:
+		if _, ok = value.(json.Number); !ok {
+			_, ok = toNumber(value)
+		}
+
+	case BINARY_ATTRIBUTE:
+		var b []byte
+		b, ok = value.([]byte)
+		ok = ok && len(b) > 0
+	}
+
+	if !ok {
+		return fmt.Errorf("%v: %v should be of type %v", ERR_INVALID_KEY, key.AttributeName, key.AttributeType)
+	}
+
+	return nil
+}
+
+//
+// encodeKeyValue is like EncodeAttributeValue, but encodes integer and json.Number values
+// (accepted by checkKeyValue) without converting them to floating point
+//
+func encodeKeyValue(key AttributeDefinition, value interface{}) AttributeValue {
+	if key.AttributeType == NUMBER_ATTRIBUTE {
+		switch value.(type) {
+		case uint, uint8, uint32, uint64, int, int8, int32, int64, json.Number:
+			return EncodeValue(value)
+		}
+	}
+
+	return EncodeAttributeValue(key, value)
+}
+
+//
+// KeyOf extracts the primary key (hash and range key, if present) from the item,
+// verifying that the key attributes have the correct type
+//
+func (table *TableInstance) KeyOf(item Item) (Item, error) {
+	key := Item{}
+
+	for _, k := range table.Keys {
+		if k == nil {
+			continue
+		}
+
+		v := item[k.AttributeName]
+		if err := checkKeyValue(k, v); err != nil {
+			return nil, err
+		}
+
+		key[k.AttributeName] = v
+	}
+
+	return key, nil
+}
+
+//
+// ValidateItem returns an error if the item is missing the key attributes or if they have the wrong type
+//
+func (table *TableInstance) ValidateItem(item Item) error {
+	_, err := table.KeyOf(item)
+	return err
+}
+
+//
+// ValidateKeys makes TableInstance.PutItem check the item key attributes (see ValidateItem)
+// before sending the request, instead of relying on DynamoDB to reject the item
+//
+func ValidateKeys() ItemOption {
+	return func(req *ItemRequest) {
+		req.validateKeys = true
+	}
+}
+
+//
+// keyValues returns the hash and range key values from a key map (or a full item)
+//
+func (table *TableInstance) keyValues(key Item) (interface{}, interface{}, error) {
+	key, err := table.KeyOf(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rangeKey interface{}
+	if table.HashRange() {
+		rangeKey = key[table.RangeKey().AttributeName]
+	}
+
+	return key[table.HashKey().AttributeName], rangeKey, nil
+}
+
+//
+// GetItemByKey is like GetItem, with the key passed as a map (or a full item)
+//
+func (table *TableInstance) GetItemByKey(key Item, attributes []string, consistent bool, consumed bool, options ...GetItemOption) (map[string]interface{}, ConsumedCapacityDescription, error) {
+	hashKey, rangeKey, err := table.keyValues(key)
+	if err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	return table.GetItem(hashKey, rangeKey, attributes, consistent, consumed, options...)
+}
+
+//
+// UpdateItemByKey is like UpdateItem, with the key passed as a map (or a full item)
+//
+func (table *TableInstance) UpdateItemByKey(key Item, updates string, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
+	hashKey, rangeKey, err := table.keyValues(key)
+	if err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	return table.UpdateItem(hashKey, rangeKey, updates, options...)
+}
+
+//
+// DeleteItemByKey is like DeleteItem, with the key passed as a map (or a full item)
+//
+func (table *TableInstance) DeleteItemByKey(key Item, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
+	hashKey, rangeKey, err := table.keyValues(key)
+	if err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	return table.DeleteItem(hashKey, rangeKey, options...)
+}
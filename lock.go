@@ -0,0 +1,280 @@
+package dynago
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	LOCK_OWNER   = "Owner"
+	LOCK_EXPIRES = "Expires" // milliseconds since Unix epoch
+
+	DEFAULT_LOCK_LEASE = 30 * time.Second
+)
+
+var (
+	ERR_LOCK_HELD     = errors.New("lock held by another owner")
+	ERR_LOCK_NOT_HELD = errors.New("lock not held")
+)
+
+//
+// LockClient implements distributed locks (with leases) on a DynamoDB table with a string hash key.
+//
+// A lock is acquired by writing an item with the owner id and the lease expiration time, only if the
+// item doesn't exist or the lease has expired. While the lock is held a background goroutine renews the lease.
+//
+// Lease expiration is based on the local clock of the clients, so clocks should be reasonably in sync
+// (the lease duration should be much larger than the clock skew).
+//
+type LockClient struct {
+	table     *TableInstance
+	owner     string
+	lease     time.Duration
+	heartbeat time.Duration
+}
+
+type LockOption func(*LockClient)
+
+//
+// LkOwner sets the owner id (default: hostname, process id and a random string)
+//
+func LkOwner(owner string) LockOption {
+	return func(c *LockClient) {
+		c.owner = owner
+	}
+}
+
+//
+// LkLease sets the lease duration and the interval between lease renewals
+// (heartbeat should be less than lease; if 0 it's set to lease/3)
+//
+func LkLease(lease, heartbeat time.Duration) LockOption {
+	return func(c *LockClient) {
+		c.lease = lease
+		c.heartbeat = heartbeat
+	}
+}
+
+func NewLockClient(table *TableInstance, options ...LockOption) *LockClient {
+	c := &LockClient{table: table, lease: DEFAULT_LOCK_LEASE}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if len(c.owner) == 0 {
+		c.owner = defaultOwner()
+	}
+
+	if c.heartbeat <= 0 || c.heartbeat >= c.lease {
+		c.heartbeat = c.lease / 3
+	}
+
+	return c
+}
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return fmt.Sprintf("%v-%v-%v", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+//
+// CreateLockTable creates a table suitable for LockClient
+//
+func (db *DBClient) CreateLockTable(tableName string, rc, wc int) (*TableInstance, error) {
+	attributes := []AttributeDefinition{AttributeDefinition{"LockName", STRING_ATTRIBUTE}}
+	return db.CreateTableInstance(tableName, attributes, []string{"LockName"}, rc, wc, STREAM_VIEW_DISABLED)
+}
+
+func (c *LockClient) Owner() string {
+	return c.owner
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (c *LockClient) key(name string) *KeyValue {
+	return &KeyValue{*c.table.HashKey(), name}
+}
+
+//
+// Acquire tries to acquire the named lock. It returns ERR_LOCK_HELD if the lock is held by another owner
+// and the lease has not expired. Acquiring a lock already held by the same owner renews it.
+//
+func (c *LockClient) Acquire(name string) (*Lock, error) {
+	now := time.Now()
+	expires := now.Add(c.lease)
+
+	item := Item{
+		c.table.HashKey().AttributeName: name,
+		LOCK_OWNER:                      c.owner,
+		LOCK_EXPIRES:                    millis(expires),
+	}
+
+	_, _, err := c.table.DB.PutItem(c.table.Name, item,
+		ConditionExpression("attribute_not_exists(#owner) OR #expires < :now OR #owner = :owner"),
+		ExpressionAttributeNames(map[string]string{"#owner": LOCK_OWNER, "#expires": LOCK_EXPIRES}),
+		ExpressionAttributeValues(map[string]interface{}{":now": millis(now), ":owner": c.owner}))
+
+	if isDBError(err, errorConditionalCheckFailed) {
+		return nil, ERR_LOCK_HELD
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lock{
+		Name:    name,
+		client:  c,
+		expires: expires,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	go lock.renew()
+	return lock, nil
+}
+
+//
+// AcquireWait tries to acquire the named lock until it succeeds or the timeout expires,
+// waiting retry between attempts
+//
+func (c *LockClient) AcquireWait(name string, timeout, retry time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		lock, err := c.Acquire(name)
+		if err != ERR_LOCK_HELD {
+			return lock, err
+		}
+
+		if time.Now().Add(retry).After(deadline) {
+			return nil, err
+		}
+
+		time.Sleep(retry)
+	}
+}
+
+//
+// Lock is a lock acquired by LockClient. The lease is renewed in background until Release is called
+// or the lock is lost.
+//
+type Lock struct {
+	Name string
+
+	client  *LockClient
+	lock    sync.Mutex
+	expires time.Time
+	stop    chan struct{}
+	stopped sync.Once
+	done    chan struct{}
+	lost    chan struct{}
+	err     error
+}
+
+//
+// Expires returns the current lease expiration time
+//
+func (l *Lock) Expires() time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.expires
+}
+
+//
+// Lost returns a channel that is closed if the lease couldn't be renewed
+// (the lock was taken over by someone else or the lease expired)
+//
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+//
+// Err returns the reason the lock was lost
+//
+func (l *Lock) Err() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.err
+}
+
+func (l *Lock) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.client.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-ticker.C:
+		}
+
+		c := l.client
+		expires := time.Now().Add(c.lease)
+
+		_, _, err := c.table.DB.UpdateItem(c.table.Name, c.key(l.Name), nil,
+			"SET #expires = :expires",
+			ConditionExpression("#owner = :owner"),
+			ExpressionAttributeNames(map[string]string{"#owner": LOCK_OWNER, "#expires": LOCK_EXPIRES}),
+			ExpressionAttributeValues(map[string]interface{}{":expires": millis(expires), ":owner": c.owner}))
+
+		l.lock.Lock()
+
+		if err == nil {
+			l.expires = expires
+		} else if isDBError(err, errorConditionalCheckFailed) || time.Now().After(l.expires) {
+			if isDBError(err, errorConditionalCheckFailed) {
+				l.err = ERR_LOCK_NOT_HELD
+			} else {
+				l.err = err
+			}
+
+			l.lock.Unlock()
+			close(l.lost)
+			return
+		}
+
+		// other errors: retry at the next heartbeat, until the lease expires
+
+		l.lock.Unlock()
+	}
+}
+
+//
+// Release stops renewing the lease and deletes the lock (if still owned).
+// It returns ERR_LOCK_NOT_HELD if the lock was lost.
+//
+func (l *Lock) Release() error {
+	l.stopped.Do(func() { close(l.stop) })
+	<-l.done
+
+	c := l.client
+
+	_, _, err := c.table.DB.DeleteItem(c.table.Name, c.key(l.Name), nil,
+		ConditionExpression("#owner = :owner"),
+		ExpressionAttributeNames(map[string]string{"#owner": LOCK_OWNER}),
+		ExpressionAttributeValues(map[string]interface{}{":owner": c.owner}))
+
+	if isDBError(err, errorConditionalCheckFailed) {
+		return ERR_LOCK_NOT_HELD
+	}
+
+	return err
+}
@@ -0,0 +1,169 @@
+package dynago
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Logging
+//
+
+const (
+	LOG_REDACTED = "REDACTED"
+	LOG_MASKED   = "***"
+)
+
+var (
+	// fields that are always redacted in the logged request/response bodies
+	redactedFields = map[string]bool{
+		"accesskey":       true,
+		"accesskeyid":     true,
+		"secretkey":       true,
+		"secretaccesskey": true,
+		"sessiontoken":    true,
+		"authorization":   true,
+		"password":        true,
+	}
+)
+
+//
+// LogEntry is the structure of a log line (one JSON object for each request)
+//
+type LogEntry struct {
+	Time     time.Time   `json:"time"`
+	Action   string      `json:"action"`
+	Table    string      `json:"table,omitempty"`
+	Duration float64     `json:"duration_ms"`
+	Consumed float32     `json:"consumed,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Request  interface{} `json:"request,omitempty"`
+	Response interface{} `json:"response,omitempty"`
+}
+
+type requestLogger struct {
+	lock   sync.Mutex
+	w      io.Writer
+	bodies bool
+	masked map[string]bool
+}
+
+type LogOption func(*requestLogger)
+
+//
+// LgBodies enables logging of request and response bodies
+//
+func LgBodies(enable bool) LogOption {
+	return func(l *requestLogger) {
+		l.bodies = enable
+	}
+}
+
+//
+// LgMask masks the values of the named attributes in the logged bodies (i.e. for PII).
+// When masking is enabled the expression attribute values and the statement parameters are also masked,
+// since they can't be associated to attribute names.
+//
+func LgMask(attributes ...string) LogOption {
+	return func(l *requestLogger) {
+		for _, name := range attributes {
+			l.masked[name] = true
+		}
+	}
+}
+
+//
+// SetLogger logs all the requests to w as JSON lines (see LogEntry), with credentials redacted
+//
+func (db *DBClient) SetLogger(w io.Writer, options ...LogOption) *DBClient {
+	l := &requestLogger{w: w, masked: map[string]bool{}}
+
+	for _, option := range options {
+		option(l)
+	}
+
+	return db.Use(Observe(l.log))
+}
+
+func (l *requestLogger) log(action string, input, output interface{}, err error, elapsed time.Duration) {
+	entry := LogEntry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Table:    requestTable(input),
+		Duration: float64(elapsed) / float64(time.Millisecond),
+	}
+
+	for _, c := range consumedCapacity(output) {
+		entry.Consumed += c.CapacityUnits
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if l.bodies {
+		entry.Request = l.redact(input)
+
+		if output != nil {
+			entry.Response = l.redact(output)
+		}
+	}
+
+	data, jerr := json.Marshal(entry)
+	if jerr != nil {
+		return
+	}
+
+	l.lock.Lock()
+	l.w.Write(append(data, '\n'))
+	l.lock.Unlock()
+}
+
+//
+// redact returns a generic copy of v (as decoded from JSON) with secrets redacted and attributes masked
+//
+func (l *requestLogger) redact(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+
+	return l.redactValue(generic)
+}
+
+func (l *requestLogger) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, vv := range v {
+			switch {
+			case redactedFields[strings.ToLower(k)]:
+				v[k] = LOG_REDACTED
+
+			case l.masked[k]:
+				v[k] = LOG_MASKED
+
+			case len(l.masked) > 0 && (k == "ExpressionAttributeValues" || k == "Parameters"):
+				v[k] = LOG_MASKED
+
+			default:
+				v[k] = l.redactValue(vv)
+			}
+		}
+
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = l.redactValue(vv)
+		}
+	}
+
+	return v
+}
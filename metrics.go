@@ -0,0 +1,315 @@
+package dynago
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Metrics
+//
+
+var (
+	// upper bounds (in seconds) of the latency histogram buckets
+	DEFAULT_LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	readActions = map[string]bool{
+		"GetItem":      true,
+		"BatchGetItem": true,
+		"Query":        true,
+		"Scan":         true,
+	}
+)
+
+//
+// OperationStats are the metrics for one operation (action) on one table
+//
+type OperationStats struct {
+	Table  string
+	Action string
+
+	Count     uint64
+	Errors    uint64
+	Retries   uint64
+	Throttles uint64
+
+	ReadUnits  float64
+	WriteUnits float64
+
+	LatencySum     float64  // seconds
+	LatencyBuckets []uint64 // cumulative counts, one for each bucket plus +Inf
+}
+
+//
+// Metrics collects per-table, per-operation metrics for a DBClient (see DBClient.EnableMetrics).
+//
+// Consumed units are only available for requests that ask for the consumed capacity.
+//
+type Metrics struct {
+	buckets []float64
+
+	lock sync.Mutex
+	ops  map[string]*OperationStats
+}
+
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DEFAULT_LATENCY_BUCKETS
+	}
+
+	return &Metrics{buckets: buckets, ops: map[string]*OperationStats{}}
+}
+
+//
+// EnableMetrics creates a metrics collector and installs it as middleware and retry observer
+//
+func (db *DBClient) EnableMetrics() *Metrics {
+	m := NewMetrics()
+
+	db.Use(m.Middleware())
+	db.OnRetry(m.observeRetry)
+	return m
+}
+
+func (m *Metrics) stats(table, action string) *OperationStats {
+	key := table + "/" + action
+
+	s, ok := m.ops[key]
+	if !ok {
+		s = &OperationStats{Table: table, Action: action, LatencyBuckets: make([]uint64, len(m.buckets)+1)}
+		m.ops[key] = s
+	}
+
+	return s
+}
+
+//
+// Middleware returns the middleware that collects the request metrics
+//
+func (m *Metrics) Middleware() Middleware {
+	return Observe(m.observe)
+}
+
+func (m *Metrics) observe(action string, input, output interface{}, err error, elapsed time.Duration) {
+	table := requestTable(input)
+	latency := elapsed.Seconds()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.stats(table, action)
+	s.Count++
+	s.LatencySum += latency
+
+	for i, b := range m.buckets {
+		if latency <= b {
+			s.LatencyBuckets[i]++
+		}
+	}
+
+	s.LatencyBuckets[len(m.buckets)]++
+
+	if err != nil {
+		s.Errors++
+
+		if isThrottling(err) {
+			s.Throttles++
+		}
+
+		return
+	}
+
+	read := readActions[action]
+	if req, ok := input.(*StatementRequest); ok {
+		read = strings.HasPrefix(strings.ToUpper(strings.TrimSpace(req.Statement)), "SELECT")
+	}
+
+	for _, c := range consumedCapacity(output) {
+		cs := s
+		if len(c.TableName) > 0 && c.TableName != table {
+			cs = m.stats(c.TableName, action)
+		}
+
+		switch {
+		case c.ReadCapacityUnits > 0 || c.WriteCapacityUnits > 0:
+			// transactions (and INDEXES responses) report the read/write split
+			cs.ReadUnits += float64(c.ReadCapacityUnits)
+			cs.WriteUnits += float64(c.WriteCapacityUnits)
+
+		case read:
+			cs.ReadUnits += float64(c.CapacityUnits)
+
+		default:
+			cs.WriteUnits += float64(c.CapacityUnits)
+		}
+	}
+}
+
+func (m *Metrics) observeRetry(action string, input interface{}, attempt int, err error) {
+	table := requestTable(input)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s := m.stats(table, action)
+	s.Retries++
+
+	if isThrottling(err) {
+		s.Throttles++
+	}
+}
+
+//
+// requestTable returns the table name from the request (the TableName field, or the only table in RequestItems)
+//
+func requestTable(input interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(input))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	if f := v.FieldByName("TableName"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+
+	if f := v.FieldByName("RequestItems"); f.IsValid() && f.Kind() == reflect.Map && f.Len() == 1 {
+		return f.MapKeys()[0].String()
+	}
+
+	return ""
+}
+
+//
+// consumedCapacity returns the ConsumedCapacity field of the response, if present
+//
+func consumedCapacity(output interface{}) []ConsumedCapacityDescription {
+	v := reflect.Indirect(reflect.ValueOf(output))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	switch c := v.FieldByName("ConsumedCapacity"); {
+	case !c.IsValid():
+		return nil
+
+	case c.Type() == reflect.TypeOf(ConsumedCapacityDescription{}):
+		return []ConsumedCapacityDescription{c.Interface().(ConsumedCapacityDescription)}
+
+	case c.Type() == reflect.TypeOf([]ConsumedCapacityDescription{}):
+		return c.Interface().([]ConsumedCapacityDescription)
+	}
+
+	return nil
+}
+
+//
+// Snapshot returns a copy of the current metrics, sorted by table and action
+//
+func (m *Metrics) Snapshot() []OperationStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshot := make([]OperationStats, 0, len(m.ops))
+	for _, s := range m.ops {
+		c := *s
+		c.LatencyBuckets = append([]uint64(nil), s.LatencyBuckets...)
+		snapshot = append(snapshot, c)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Table != snapshot[j].Table {
+			return snapshot[i].Table < snapshot[j].Table
+		}
+
+		return snapshot[i].Action < snapshot[j].Action
+	})
+
+	return snapshot
+}
+
+//
+// Reset clears all the metrics
+//
+func (m *Metrics) Reset() {
+	m.lock.Lock()
+	m.ops = map[string]*OperationStats{}
+	m.lock.Unlock()
+}
+
+//
+// String returns the metrics snapshot as JSON, so that Metrics can be published with expvar.Publish
+//
+func (m *Metrics) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "null"
+	}
+
+	return string(data)
+}
+
+//
+// WritePrometheus writes the metrics in Prometheus text exposition format
+//
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snapshot := m.Snapshot()
+
+	counters := []struct {
+		name, help string
+		value      func(s *OperationStats) float64
+	}{
+		{"dynago_requests_total", "Number of requests.", func(s *OperationStats) float64 { return float64(s.Count) }},
+		{"dynago_errors_total", "Number of failed requests.", func(s *OperationStats) float64 { return float64(s.Errors) }},
+		{"dynago_retries_total", "Number of retried requests.", func(s *OperationStats) float64 { return float64(s.Retries) }},
+		{"dynago_throttles_total", "Number of throttled requests.", func(s *OperationStats) float64 { return float64(s.Throttles) }},
+		{"dynago_consumed_read_units_total", "Consumed read capacity units.", func(s *OperationStats) float64 { return s.ReadUnits }},
+		{"dynago_consumed_write_units_total", "Consumed write capacity units.", func(s *OperationStats) float64 { return s.WriteUnits }},
+	}
+
+	for _, c := range counters {
+		if _, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n", c.name, c.help, c.name); err != nil {
+			return err
+		}
+
+		for i := range snapshot {
+			s := &snapshot[i]
+			if _, err := fmt.Fprintf(w, "%v{%v} %v\n", c.name, promLabels(s.Table, s.Action), c.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := "dynago_request_duration_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %v Request latency.\n# TYPE %v histogram\n", name, name); err != nil {
+		return err
+	}
+
+	for _, s := range snapshot {
+		labels := promLabels(s.Table, s.Action)
+
+		for i, b := range m.buckets {
+			if _, err := fmt.Fprintf(w, "%v_bucket{%v,le=\"%v\"} %v\n", name, labels, b, s.LatencyBuckets[i]); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "%v_bucket{%v,le=\"+Inf\"} %v\n%v_sum{%v} %v\n%v_count{%v} %v\n",
+			name, labels, s.Count, name, labels, s.LatencySum, name, labels, s.Count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func promLabels(table, action string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return fmt.Sprintf(`table="%v",action="%v"`, escape.Replace(table), escape.Replace(action))
+}
@@ -0,0 +1,234 @@
+package dynago
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/raff/aws4"
+	"github.com/raff/aws4/dydb"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Middleware
+//
+
+//
+// QueryFunc executes the DynamoDB action with the input request and decodes the response in output
+//
+type QueryFunc func(action string, input, output interface{}) error
+
+//
+// Middleware wraps a QueryFunc, to intercept all the requests executed by DBClient.Query.
+//
+// A middleware can inspect or rewrite the input before calling next, inspect the output and the error
+// after calling next, or skip next altogether (i.e. for fault injection)
+//
+type Middleware func(next QueryFunc) QueryFunc
+
+//
+// QueryObserver is called after each request, with the request, the decoded response (nil on error),
+// the error and the elapsed time
+//
+type QueryObserver func(action string, input, output interface{}, err error, elapsed time.Duration)
+
+//
+// Use adds middlewares to the client. The first middleware added is the outermost one
+// (the first to see the request and the last to see the response).
+//
+func (db *DBClient) Use(middlewares ...Middleware) *DBClient {
+	db.middlewares = append(db.middlewares, middlewares...)
+
+	var query QueryFunc = db.retryQuery
+
+	for i := len(db.middlewares) - 1; i >= 0; i-- {
+		query = db.middlewares[i](query)
+	}
+
+	db.query = query
+	return db
+}
+
+//
+// Observe returns a middleware that calls observer after each request
+//
+func Observe(observer QueryObserver) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		return func(action string, input, output interface{}) error {
+			start := time.Now()
+			err := next(action, input, output)
+
+			if err != nil {
+				observer(action, input, nil, err, time.Since(start))
+			} else {
+				observer(action, input, output, nil, time.Since(start))
+			}
+
+			return err
+		}
+	}
+}
+
+//
+// RetryObserver is called every time a request fails with a retryable error and is going to be retried
+//
+type RetryObserver func(action string, input interface{}, attempt int, err error)
+
+//
+// OnRetry adds an observer for retried requests
+//
+func (db *DBClient) OnRetry(observer RetryObserver) *DBClient {
+	db.retryObservers = append(db.retryObservers, observer)
+
+	if db.query == nil {
+		// the retry observers are called by retryQuery, at the end of the chain
+		db.Use()
+	}
+
+	return db
+}
+
+func isThrottling(err error) bool {
+	return isDBError(err, errorThroughputExceeded) || isDBError(err, errorThrottling) || isDBError(err, errorRequestLimitExceeded)
+}
+
+//
+// retryQuery executes the request with dydb.DB.RetryQuery (as Query does without middlewares).
+//
+// If there are retry observers the HTTP requests are intercepted, so that the observers
+// can be notified before each retry.
+//
+func (db *DBClient) retryQuery(action string, input, output interface{}) error {
+	d := db.snapshot()
+
+	if len(db.retryObservers) > 0 {
+		d.Client = observedClient(d, &retryTransport{
+			db:     *d,
+			action: action,
+			input:  input,
+			notify: func(attempt int, err error) {
+				for _, observer := range db.retryObservers {
+					observer(action, input, attempt, err)
+				}
+			},
+		})
+	}
+
+	return d.RetryQuery(action, input, RETRY_COUNT).Decode(output)
+}
+
+//
+// observedClient returns a copy of the client used by d that sends the requests through transport
+//
+func observedClient(d *dydb.DB, transport *retryTransport) *aws4.Client {
+	client := d.Client
+	if client == nil {
+		client = aws4.DefaultClient
+	}
+
+	observed := *client
+
+	var hc http.Client
+	if client.Client != nil {
+		hc = *client.Client
+	}
+
+	transport.base = hc.Transport
+	if transport.base == nil {
+		transport.base = http.DefaultTransport
+	}
+
+	hc.Transport = transport
+	observed.Client = &hc
+	return &observed
+}
+
+//
+// retryTransport counts the HTTP requests sent for one call to RetryQuery
+// and calls notify with the error of the previous attempt before each retry
+//
+type retryTransport struct {
+	base   http.RoundTripper
+	db     dydb.DB
+	action string
+	input  interface{}
+	notify func(attempt int, err error)
+
+	attempts int
+	lastErr  error
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.attempts > 0 && t.lastErr != nil {
+		t.notify(t.attempts, t.lastErr)
+	}
+
+	t.attempts++
+
+	resp, err := t.base.RoundTrip(req)
+	if t.lastErr = err; err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.lastErr = t.responseError(resp, body)
+	return resp, nil
+}
+
+//
+// responseError returns the error for a failed response, as decoded by dydb
+// (so that it can be checked with the same functions used for the errors returned by Query)
+//
+func (t *retryTransport) responseError(resp *http.Response, body []byte) error {
+	replay := t.db
+	replay.Client = &aws4.Client{
+		Keys:   aws4.DefaultClient.Keys,
+		Client: &http.Client{Transport: &replayTransport{resp: resp, body: body}},
+	}
+
+	if t.db.Client != nil {
+		replay.Client.Keys = t.db.Client.Keys
+	}
+
+	return replay.Query(t.action, t.input).Decode(nil)
+}
+
+//
+// replayTransport returns a copy of the same response to every request
+//
+type replayTransport struct {
+	resp *http.Response
+	body []byte
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := *t.resp
+	resp.Request = req
+	resp.Body = ioutil.NopCloser(bytes.NewReader(t.body))
+	return &resp, nil
+}
+
+//
+// chainDecoder executes the middleware chain when the response is decoded
+//
+type chainDecoder struct {
+	query  QueryFunc
+	action string
+	input  interface{}
+}
+
+func (d *chainDecoder) Decode(output interface{}) error {
+	return d.query(d.action, d.input, output)
+}
+
+func (db *DBClient) chainQuery(action string, v interface{}) dydb.Decoder {
+	return &chainDecoder{query: db.query, action: action, input: v}
+}
@@ -0,0 +1,186 @@
+package dynago
+
+import (
+	"fmt"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// ExecuteStatement (PartiQL)
+//
+
+type StatementRequest struct {
+	Statement              string
+	Parameters             []AttributeValue `json:",omitempty"`
+	ConsistentRead         bool             `json:",omitempty"`
+	NextToken              string           `json:",omitempty"`
+	Limit                  int              `json:",omitempty"`
+	ReturnConsumedCapacity string           `json:",omitempty"`
+}
+
+type StatementResult struct {
+	Items            []Item
+	NextToken        string
+	LastEvaluatedKey AttributeNameValue
+	ConsumedCapacity ConsumedCapacityDescription
+}
+
+//
+// Statement creates a PartiQL statement request. The parameters replace the "?" placeholders
+// in the statement and are encoded with EncodeValue
+//
+func Statement(statement string, params ...interface{}) *StatementRequest {
+	return &StatementRequest{Statement: statement, Parameters: encodeParameters(params)}
+}
+
+func encodeParameters(params []interface{}) []AttributeValue {
+	if len(params) == 0 {
+		return nil
+	}
+
+	values := make([]AttributeValue, len(params))
+	for i, p := range params {
+		values[i] = EncodeValue(p)
+	}
+
+	return values
+}
+
+func (req *StatementRequest) SetConsistentRead(consistent bool) *StatementRequest {
+	req.ConsistentRead = consistent
+	return req
+}
+
+func (req *StatementRequest) SetNextToken(token string) *StatementRequest {
+	req.NextToken = token
+	return req
+}
+
+func (req *StatementRequest) SetLimit(limit int) *StatementRequest {
+	req.Limit = limit
+	return req
+}
+
+func (req *StatementRequest) SetConsumed(consumed bool) *StatementRequest {
+	req.ReturnConsumedCapacity = RETURN_CONSUMED[consumed]
+	return req
+}
+
+//
+// SetReturnConsumed sets the consumed capacity detail (RETURN_TOTAL_CONSUMED, RETURN_INDEX_CONSUMED or RETURN_NONE)
+//
+func (req *StatementRequest) SetReturnConsumed(target string) *StatementRequest {
+	req.ReturnConsumedCapacity = target
+	return req
+}
+
+//
+// Exec executes one page of the statement and returns the items and the token for the next page
+//
+func (req *StatementRequest) Exec(db *DBClient) ([]Item, string, ConsumedCapacityDescription, error) {
+	var res StatementResult
+
+	if err := db.Query("ExecuteStatement", req).Decode(&res); err != nil {
+		return nil, "", ConsumedCapacityDescription{}, err
+	}
+
+	return res.Items, res.NextToken, res.ConsumedCapacity, nil
+}
+
+//
+// ExecAll executes the statement following NextToken until all the items have been returned
+//
+func (req *StatementRequest) ExecAll(db *DBClient) ([]Item, ConsumedCapacityDescription, error) {
+	var items []Item
+	var consumed ConsumedCapacityDescription
+
+	creq := *req
+
+	for {
+		page, next, cons, err := creq.Exec(db)
+		if err != nil {
+			return nil, consumed, err
+		}
+
+		items = append(items, page...)
+		consumed.Add(cons)
+
+		if len(next) == 0 {
+			return items, consumed, nil
+		}
+
+		creq.NextToken = next
+	}
+}
+
+//
+// ExecuteStatement executes a PartiQL statement and returns all the resulting items
+//
+func (db *DBClient) ExecuteStatement(statement string, params ...interface{}) ([]Item, error) {
+	items, _, err := Statement(statement, params...).ExecAll(db)
+	return items, err
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// BatchExecuteStatement (PartiQL)
+//
+
+type BatchStatementRequest struct {
+	Statement      string
+	Parameters     []AttributeValue `json:",omitempty"`
+	ConsistentRead bool             `json:",omitempty"`
+}
+
+//
+// BatchStatement creates a statement for BatchExecuteStatement (see Statement)
+//
+func BatchStatement(statement string, params ...interface{}) BatchStatementRequest {
+	return BatchStatementRequest{Statement: statement, Parameters: encodeParameters(params)}
+}
+
+type BatchStatementError struct {
+	Code    string
+	Message string
+}
+
+func (err *BatchStatementError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Code, err.Message)
+}
+
+//
+// BatchStatementResponse is the result of one of the statements in BatchExecuteStatement.
+// If the statement failed Error is not nil
+//
+type BatchStatementResponse struct {
+	TableName string
+	Item      Item
+	Error     *BatchStatementError
+}
+
+type BatchExecuteStatementRequest struct {
+	Statements             []BatchStatementRequest
+	ReturnConsumedCapacity string `json:",omitempty"`
+}
+
+type BatchExecuteStatementResult struct {
+	Responses        []BatchStatementResponse
+	ConsumedCapacity []ConsumedCapacityDescription
+}
+
+//
+// BatchExecuteStatement executes multiple PartiQL statements (all reads or all writes)
+// and returns the responses and the capacity consumed on each table.
+// The responses are in the same order as the statements; a failure of a single statement
+// is reported in the corresponding response Error.
+//
+func (db *DBClient) BatchExecuteStatement(statements []BatchStatementRequest, consumed bool) ([]BatchStatementResponse, []ConsumedCapacityDescription, error) {
+	var req = BatchExecuteStatementRequest{Statements: statements, ReturnConsumedCapacity: RETURN_CONSUMED[consumed]}
+	var res BatchExecuteStatementResult
+
+	if err := db.Query("BatchExecuteStatement", &req).Decode(&res); err != nil {
+		return nil, nil, err
+	}
+
+	return res.Responses, res.ConsumedCapacity, nil
+}
@@ -0,0 +1,355 @@
+package dynago
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_PROCESSOR_WORKERS    = 4
+	DEFAULT_PROCESSOR_BATCH_SIZE = 100
+	DEFAULT_PROCESSOR_RETRIES    = 3
+	DEFAULT_PROCESSOR_RETRY_WAIT = time.Second
+)
+
+//
+// DeadLetterHandler is called by StreamProcessor with the batches that failed after all the retries
+//
+type DeadLetterHandler func(shardId string, records []Record, err error)
+
+//
+// StreamProcessor consumes the shards of a stream concurrently and dispatches batches of records
+// to a pool of workers.
+//
+// Records are assigned to workers according to their key, and the processor waits for all
+// the records returned by a GetRecords call to be processed before reading the next ones,
+// so records for the same key are always processed in order.
+//
+// A batch that fails is retried (with exponential backoff) and then passed to the dead letter handler.
+// If there is no dead letter handler the processor stops and returns the error.
+//
+type StreamProcessor struct {
+	reader     *StreamReader
+	handler    BatchHandler
+	deadLetter DeadLetterHandler
+
+	workers    int
+	batchSize  int
+	retries    int
+	retryWait  time.Duration
+	queues     []chan *processorJob
+	workerDone sync.WaitGroup
+}
+
+type ProcessorOption func(*StreamProcessor)
+
+func SpWorkers(workers int) ProcessorOption {
+	return func(p *StreamProcessor) {
+		p.workers = workers
+	}
+}
+
+//
+// SpBatchSize sets the maximum number of records passed to the handler in one call
+//
+func SpBatchSize(size int) ProcessorOption {
+	return func(p *StreamProcessor) {
+		p.batchSize = size
+	}
+}
+
+//
+// SpRetry sets the number of times a failed batch is retried and the wait before the first retry
+// (doubled at every retry)
+//
+func SpRetry(retries int, wait time.Duration) ProcessorOption {
+	return func(p *StreamProcessor) {
+		p.retries = retries
+		p.retryWait = wait
+	}
+}
+
+func SpDeadLetter(handler DeadLetterHandler) ProcessorOption {
+	return func(p *StreamProcessor) {
+		p.deadLetter = handler
+	}
+}
+
+//
+// NewStreamProcessor creates a processor that reads the stream using reader
+// (and its iterator, checkpoint and wait settings) and calls handler for each batch of records
+//
+func NewStreamProcessor(reader *StreamReader, handler BatchHandler, options ...ProcessorOption) *StreamProcessor {
+	p := &StreamProcessor{
+		reader:    reader,
+		handler:   handler,
+		workers:   DEFAULT_PROCESSOR_WORKERS,
+		batchSize: DEFAULT_PROCESSOR_BATCH_SIZE,
+		retries:   DEFAULT_PROCESSOR_RETRIES,
+		retryWait: DEFAULT_PROCESSOR_RETRY_WAIT,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.workers < 1 {
+		p.workers = 1
+	}
+
+	if p.batchSize < 1 {
+		p.batchSize = 1
+	}
+
+	return p
+}
+
+//
+// Process processes all the records currently available in the stream
+//
+func (p *StreamProcessor) Process() error {
+	p.start()
+	defer p.stop()
+
+	for {
+		_, progress, err := p.pass(nil)
+		if err != nil || !progress {
+			return err
+		}
+	}
+}
+
+//
+// Run processes the records of the stream continuously, until a batch fails (and there is no dead letter handler),
+// the stop channel is closed or the stream is disabled and all the shards have been processed
+//
+func (p *StreamProcessor) Run(stop <-chan struct{}) error {
+	p.start()
+	defer p.stop()
+
+	return p.reader.follow(func() (int, error) {
+		total := 0
+
+		for {
+			count, progress, err := p.pass(stop)
+			total += count
+
+			if err != nil || !progress || isStopped(stop) {
+				return total, err
+			}
+		}
+	}, stop)
+}
+
+//
+// pass reads all the shards that are ready until there are no more records (or the stop channel is closed).
+// The shards are read in rounds, one batch per shard in each round and up to workers shards concurrently,
+// so that all the shards (and their checkpoints) advance even if one of them is busy.
+//
+// It returns the number of records read and true if any shard was completed (so that children shards may be ready)
+//
+func (p *StreamProcessor) pass(stop <-chan struct{}) (count int, progress bool, err error) {
+	if err = p.reader.Refresh(); err != nil {
+		return
+	}
+
+	for shards := p.reader.Ready(); len(shards) > 0 && err == nil && !isStopped(stop); {
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		var active []*ShardDescription
+
+		readers := make(chan struct{}, p.workers)
+
+		for _, shard := range shards {
+			wg.Add(1)
+			readers <- struct{}{}
+
+			go func(shard *ShardDescription) {
+				defer func() {
+					<-readers
+					wg.Done()
+				}()
+
+				completed, n, serr := p.reader.readBatch(shard, p.dispatch)
+
+				lock.Lock()
+				defer lock.Unlock()
+
+				count += n
+
+				switch {
+				case serr != nil:
+					if err == nil {
+						err = serr
+					}
+
+				case completed:
+					progress = true
+
+				case n > 0 || !shard.IsOpen():
+					active = append(active, shard)
+				}
+			}(shard)
+		}
+
+		wg.Wait()
+
+		sort.Sort(shardsBySequence(active))
+		shards = active
+	}
+
+	return
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// workers
+//
+
+type processorJob struct {
+	shardId string
+	records []Record
+	state   *dispatchState
+}
+
+//
+// dispatchState tracks the jobs created for one call to dispatch
+//
+type dispatchState struct {
+	wg   sync.WaitGroup
+	lock sync.Mutex
+	err  error
+}
+
+func (state *dispatchState) failed() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	return state.err != nil
+}
+
+func (state *dispatchState) fail(err error) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.err == nil {
+		state.err = err
+	}
+}
+
+func (p *StreamProcessor) start() {
+	p.queues = make([]chan *processorJob, p.workers)
+
+	for i := range p.queues {
+		p.queues[i] = make(chan *processorJob, 1)
+		p.workerDone.Add(1)
+
+		go p.work(p.queues[i])
+	}
+}
+
+func (p *StreamProcessor) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	p.workerDone.Wait()
+	p.queues = nil
+}
+
+func (p *StreamProcessor) work(queue chan *processorJob) {
+	defer p.workerDone.Done()
+
+	for job := range queue {
+		// once a batch failed, skip the following ones to preserve the ordering
+		if !job.state.failed() {
+			if err := p.handle(job.shardId, job.records); err != nil {
+				job.state.fail(err)
+			}
+		}
+
+		job.state.wg.Done()
+	}
+}
+
+//
+// handle calls the handler for a batch, with retries, and passes the batch to the
+// dead letter handler if it still fails
+//
+func (p *StreamProcessor) handle(shardId string, records []Record) (err error) {
+	wait := p.retryWait
+
+	for retry := 0; ; retry++ {
+		if err = p.handler(shardId, records); err == nil {
+			return
+		}
+
+		if retry >= p.retries {
+			break
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+
+	if p.deadLetter != nil {
+		p.deadLetter(shardId, records, err)
+		return nil
+	}
+
+	return
+}
+
+//
+// dispatch splits the records in batches per worker (according to the record key)
+// and waits for all of them to be processed
+//
+func (p *StreamProcessor) dispatch(shardId string, records []Record) error {
+	batches := make([][]Record, p.workers)
+
+	for _, record := range records {
+		w := recordWorker(record, p.workers)
+		batches[w] = append(batches[w], record)
+	}
+
+	state := &dispatchState{}
+
+	for w, batch := range batches {
+		for start := 0; start < len(batch); start += p.batchSize {
+			end := start + p.batchSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+
+			state.wg.Add(1)
+			p.queues[w] <- &processorJob{shardId: shardId, records: batch[start:end], state: state}
+		}
+	}
+
+	state.wg.Wait()
+	return state.err
+}
+
+//
+// recordWorker returns the worker that should process the record, hashing the record keys
+//
+func recordWorker(record Record, workers int) int {
+	keys := record.Dynamodb.Keys
+
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	h := fnv.New32a()
+	for _, k := range names {
+		fmt.Fprintf(h, "%v=%v;", k, keys[k])
+	}
+
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,47 @@
+package dynago
+
+import (
+	"sync"
+	"time"
+)
+
+//
+// rateLimiter limits the consumed capacity units per second.
+// A nil rateLimiter doesn't limit anything.
+//
+type rateLimiter struct {
+	lock sync.Mutex
+	rate float64 // units per second
+	next time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{rate: rate}
+}
+
+//
+// wait accounts for the consumed units and waits until the rate is back within the limit
+//
+func (l *rateLimiter) wait(units float64) {
+	if l == nil || units <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	l.next = l.next.Add(time.Duration(units / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+
+	l.lock.Unlock()
+
+	time.Sleep(delay)
+}
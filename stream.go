@@ -1,10 +1,28 @@
 package dynago
 
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
 const (
 	AT_SEQUENCE    = "AT_SEQUENCE_NUMBER"
 	AFTER_SEQUENCE = "AFTER_SEQUENCE_NUMBER"
 	LAST           = "TRIM_HORIZON"
 	LATEST         = "LATEST"
+
+	STREAM_STATUS_ENABLING  = "ENABLING"
+	STREAM_STATUS_ENABLED   = "ENABLED"
+	STREAM_STATUS_DISABLING = "DISABLING"
+	STREAM_STATUS_DISABLED  = "DISABLED"
+
+	DEFAULT_STREAM_MIN_WAIT = time.Second
+	DEFAULT_STREAM_MAX_WAIT = 30 * time.Second
+
+	errorExpiredIterator = "ExpiredIteratorException"
 )
 
 type SequenceNumberRange struct {
@@ -22,8 +40,8 @@ type StreamDescription struct {
 	TableName               string
 	KeySchema               []KeySchemaElement
 	CreationRequestDateTime EpochTime
-	StreamARN               string
-	StreamId                string
+	StreamArn               string
+	StreamLabel             string
 	StreamStatus            string
 	StreamViewType          string
 	LastEvaluatedShardId    string
@@ -31,12 +49,43 @@ type StreamDescription struct {
 }
 
 type StreamRecord struct {
-	Keys           Item
-	NewImage       Item
-	OldImage       Item
-	SequenceNumber string
-	SizeBytes      int64
-	StreamViewType string
+	ApproximateCreationDateTime EpochTime
+	Keys                        Item
+	NewImage                    Item
+	OldImage                    Item
+	SequenceNumber              string
+	SizeBytes                   int64
+	StreamViewType              string
+
+	// typed images, for MatchAttributes and DiffAttributes
+	oldImage AttributeNameValue
+	newImage AttributeNameValue
+}
+
+func (r *StreamRecord) UnmarshalJSON(data []byte) error {
+	type streamRecord StreamRecord
+
+	var images struct {
+		OldImage AttributeNameValue
+		NewImage AttributeNameValue
+	}
+
+	if err := json.Unmarshal(data, (*streamRecord)(r)); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &images); err != nil {
+		return err
+	}
+
+	r.oldImage = images.OldImage
+	r.newImage = images.NewImage
+	return nil
+}
+
+type Identity struct {
+	PrincipalId string `json:"principalId"`
+	Type        string `json:"type"`
 }
 
 type Record struct {
@@ -46,6 +95,67 @@ type Record struct {
 	EventName    string       `json:"eventName"`
 	EventSource  string       `json:"eventSource"`
 	EventVersion string       `json:"eventVersion"`
+	UserIdentity *Identity    `json:"userIdentity,omitempty"` // set for TTL deletions
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// StreamsClient
+//
+
+const (
+	STREAMS_TARGET = "DynamoDBStreams"
+)
+
+//
+// StreamsClient executes DynamoDB Streams operations.
+//
+// It shares the configuration (credentials, middlewares, HTTP client) of the DBClient it was created from
+// and uses the streams endpoint for the same region.
+//
+type StreamsClient struct {
+	db *DBClient
+}
+
+//
+// NewStreamsClient creates a streams client with the same configuration of db.
+// If db uses a custom endpoint URL (i.e. DynamoDB Local) the same URL is used for the streams,
+// otherwise the streams endpoint is resolved from the region (use NewStreamsClientWithResolver
+// for FIPS or dual-stack endpoints).
+//
+func NewStreamsClient(db *DBClient) *StreamsClient {
+	return NewStreamsClientWithResolver(db, DefaultResolver)
+}
+
+//
+// NewStreamsClientWithResolver is like NewStreamsClient, using the specified resolver for the streams endpoint
+//
+func NewStreamsClientWithResolver(db *DBClient, resolver *EndpointResolver) *StreamsClient {
+	sdb := &DBClient{DB: *db.snapshot(), credentials: db.credentials, endpointErr: db.endpointErr}
+	sdb.Target = STREAMS_TARGET
+	sdb.retryObservers = db.retryObservers
+	if len(db.middlewares) > 0 || len(db.retryObservers) > 0 {
+		sdb.Use(db.middlewares...)
+	}
+
+	region := db.Region
+	if len(region) == 0 {
+		region = RegionFromURL(db.URL)
+	}
+
+	// a custom endpoint (i.e. DynamoDB Local) serves both tables and streams
+	if len(db.URL) == 0 || len(RegionFromURL(db.URL)) > 0 {
+		if url, err := resolver.Resolve(SERVICE_STREAMS, region); err != nil {
+			if sdb.endpointErr == nil {
+				sdb.endpointErr = err
+			}
+		} else {
+			sdb.URL = url
+			sdb.Region = region
+		}
+	}
+
+	return &StreamsClient{db: sdb}
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -54,14 +164,20 @@ type Record struct {
 //
 
 type ListStreamsRequest struct {
-	TableName          string `json:",omitempty"`
-	Limit              int    `json:",omitempty"`
-	ExclusiveStartItem string `json:",omitempty"`
+	TableName               string `json:",omitempty"`
+	Limit                   int    `json:",omitempty"`
+	ExclusiveStartStreamArn string `json:",omitempty"`
+}
+
+type StreamSummary struct {
+	StreamArn   string
+	StreamLabel string
+	TableName   string
 }
 
 type ListStreamsResult struct {
-	LastEvaluatedStreamId string
-	StreamIds             []string
+	LastEvaluatedStreamArn string
+	Streams                []StreamSummary
 }
 
 type ListStreamsOption func(*ListStreamsRequest)
@@ -78,13 +194,17 @@ func LsLimit(limit int) ListStreamsOption {
 	}
 }
 
-func LsStartItem(startItem string) ListStreamsOption {
+func LsStartArn(streamArn string) ListStreamsOption {
 	return func(req *ListStreamsRequest) {
-		req.ExclusiveStartItem = startItem
+		req.ExclusiveStartStreamArn = streamArn
 	}
 }
 
-func (db *DBClient) ListStreams(options ...ListStreamsOption) ([]string, error) {
+//
+// ListStreams returns a page of streams and the ARN of the last one returned
+// (empty if there are no more streams)
+//
+func (sc *StreamsClient) ListStreams(options ...ListStreamsOption) ([]StreamSummary, string, error) {
 	var req ListStreamsRequest
 	var res ListStreamsResult
 
@@ -92,10 +212,10 @@ func (db *DBClient) ListStreams(options ...ListStreamsOption) ([]string, error)
 		option(&req)
 	}
 
-	if err := db.Query("ListStreams", &req).Decode(&res); err != nil {
-		return nil, err
+	if err := sc.db.Query("ListStreams", &req).Decode(&res); err != nil {
+		return nil, "", err
 	} else {
-		return res.StreamIds, nil
+		return res.Streams, res.LastEvaluatedStreamArn, nil
 	}
 }
 
@@ -105,7 +225,7 @@ func (db *DBClient) ListStreams(options ...ListStreamsOption) ([]string, error)
 //
 
 type DescribeStreamRequest struct {
-	StreamId              string
+	StreamArn             string
 	Limit                 int    `json:",omitempty"`
 	ExclusiveStartShardId string `json:",omitempty"`
 }
@@ -128,15 +248,15 @@ func DsLimit(limit int) DescribeStreamOption {
 	}
 }
 
-func (db *DBClient) DescribeStream(streamId string, options ...DescribeStreamOption) (*StreamDescription, error) {
-	var req = DescribeStreamRequest{StreamId: streamId}
+func (sc *StreamsClient) DescribeStream(streamArn string, options ...DescribeStreamOption) (*StreamDescription, error) {
+	var req = DescribeStreamRequest{StreamArn: streamArn}
 	var res DescribeStreamResult
 
 	for _, option := range options {
 		option(&req)
 	}
 
-	if err := db.Query("DescribeStream", &req).Decode(&res); err != nil {
+	if err := sc.db.Query("DescribeStream", &req).Decode(&res); err != nil {
 		return nil, err
 	} else {
 		return &res.StreamDescription, nil
@@ -149,7 +269,7 @@ func (db *DBClient) DescribeStream(streamId string, options ...DescribeStreamOpt
 //
 
 type GetShardIteratorRequest struct {
-	StreamId          string
+	StreamArn         string
 	ShardId           string
 	ShardIteratorType string // TRIM_HORIZON | LATEST | AT_SEQUENCE_NUMBER | AFTER_SEQUENCE_NUMBER
 	SequenceNumber    string `json:",omitempty"`
@@ -159,16 +279,16 @@ type GetShardIteratorResult struct {
 	ShardIterator string
 }
 
-func (db *DBClient) GetShardIterator(streamId, shardId, shardIteratorType, sequenceNumber string) (string, error) {
+func (sc *StreamsClient) GetShardIterator(streamArn, shardId, shardIteratorType, sequenceNumber string) (string, error) {
 	var req = GetShardIteratorRequest{
-		StreamId:          streamId,
+		StreamArn:         streamArn,
 		ShardId:           shardId,
 		ShardIteratorType: shardIteratorType,
 		SequenceNumber:    sequenceNumber}
 
 	var res GetShardIteratorResult
 
-	if err := db.Query("GetShardIterator", &req).Decode(&res); err != nil {
+	if err := sc.db.Query("GetShardIterator", &req).Decode(&res); err != nil {
 		return "", err
 	} else {
 		return res.ShardIterator, nil
@@ -190,13 +310,602 @@ type GetRecordsResult struct {
 	Records           []Record
 }
 
-func (db *DBClient) GetRecords(shardIterator string, limit int) (*GetRecordsResult, error) {
+func (sc *StreamsClient) GetRecords(shardIterator string, limit int) (*GetRecordsResult, error) {
 	var req = GetRecordsRequest{ShardIterator: shardIterator, Limit: limit}
 	var res GetRecordsResult
 
-	if err := db.Query("GetRecords", &req).Decode(&res); err != nil {
+	if err := sc.db.Query("GetRecords", &req).Decode(&res); err != nil {
 		return nil, err
 	} else {
 		return &res, err
 	}
 }
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// DescribeStreamAll
+//
+
+//
+// DescribeStreamAll returns the stream description with the complete list of shards,
+// following LastEvaluatedShardId until all shards have been listed
+//
+func (sc *StreamsClient) DescribeStreamAll(streamArn string) (*StreamDescription, error) {
+	var stream *StreamDescription
+	var start string
+
+	for {
+		options := []DescribeStreamOption{}
+		if len(start) > 0 {
+			options = append(options, DsStart(start))
+		}
+
+		desc, err := sc.DescribeStream(streamArn, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		if stream == nil {
+			stream = desc
+		} else {
+			stream.Shards = append(stream.Shards, desc.Shards...)
+		}
+
+		start = desc.LastEvaluatedShardId
+		if len(start) == 0 {
+			break
+		}
+	}
+
+	stream.LastEvaluatedShardId = ""
+	return stream, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// StreamReader
+//
+
+//
+// RecordHandler is called by StreamReader for every record read from a shard.
+// Returning an error stops the reader.
+//
+type RecordHandler func(shardId string, record Record) error
+
+//
+// BatchHandler is called by StreamReader for every batch of records read from a shard.
+// Returning an error stops the reader.
+//
+type BatchHandler func(shardId string, records []Record) error
+
+//
+// StreamReader reads the records of a stream following the shard lineage:
+// a shard is only read after its parent has been completely read, so that
+// records for the same key are delivered in order.
+//
+// ReadShard and ReadShardBatches can be called concurrently for different shards,
+// but not concurrently with Refresh.
+//
+type StreamReader struct {
+	sc        *StreamsClient
+	streamArn string
+
+	iteratorType   string
+	sequenceShard  string // shard the sequence number belongs to (AT_SEQUENCE/AFTER_SEQUENCE)
+	sequenceNumber string
+	limit          int
+	checkpoints    CheckpointStore
+	minWait        time.Duration
+	maxWait        time.Duration
+
+	lock      sync.Mutex
+	status    string
+	shards    map[string]*ShardDescription
+	iterators map[string]string // current iterator for shards that are being read
+	positions map[string]string // sequence number of the last record read from each shard
+	completed map[string]bool   // shards that have been completely read
+}
+
+type StreamReaderOption func(*StreamReader)
+
+//
+// SrIterator sets the iterator type used to start reading the shards that have no parent (default: TRIM_HORIZON).
+// Child shards are always read from the beginning.
+//
+// For AT_SEQUENCE/AFTER_SEQUENCE the sequence number only applies to the shard shardId,
+// since sequence numbers are specific to a shard: the other shards with no parent are read from TRIM_HORIZON.
+// shardId is ignored for the other iterator types.
+//
+func SrIterator(iteratorType, shardId, sequenceNumber string) StreamReaderOption {
+	return func(r *StreamReader) {
+		r.iteratorType = iteratorType
+		r.sequenceShard = shardId
+		r.sequenceNumber = sequenceNumber
+	}
+}
+
+func SrLimit(limit int) StreamReaderOption {
+	return func(r *StreamReader) {
+		r.limit = limit
+	}
+}
+
+//
+// SrCheckpoint sets the store used to record the last processed sequence number for each shard.
+// Shards with a checkpoint are read starting AFTER_SEQUENCE the recorded sequence number.
+//
+func SrCheckpoint(store CheckpointStore) StreamReaderOption {
+	return func(r *StreamReader) {
+		r.checkpoints = store
+	}
+}
+
+//
+// SrWait sets the minimum and maximum time Follow waits when there are no new records.
+// The wait time doubles, up to maxWait, every time no new records are found.
+//
+func SrWait(minWait, maxWait time.Duration) StreamReaderOption {
+	return func(r *StreamReader) {
+		r.minWait = minWait
+		r.maxWait = maxWait
+	}
+}
+
+func (sc *StreamsClient) NewStreamReader(streamArn string, options ...StreamReaderOption) *StreamReader {
+	r := &StreamReader{
+		sc:           sc,
+		streamArn:    streamArn,
+		iteratorType: LAST,
+		minWait:      DEFAULT_STREAM_MIN_WAIT,
+		maxWait:      DEFAULT_STREAM_MAX_WAIT,
+		shards:       map[string]*ShardDescription{},
+		iterators:    map[string]string{},
+		positions:    map[string]string{},
+		completed:    map[string]bool{},
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
+}
+
+//
+// Refresh reloads the list of shards, adding the ones created since the last call
+// and updating the sequence number range of the known ones
+//
+func (r *StreamReader) Refresh() error {
+	stream, err := r.sc.DescribeStreamAll(r.streamArn)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.status = stream.StreamStatus
+
+	for i := range stream.Shards {
+		shard := stream.Shards[i]
+
+		if known, ok := r.shards[shard.ShardId]; ok {
+			known.SequenceNumberRange = shard.SequenceNumberRange
+		} else {
+			r.shards[shard.ShardId] = &shard
+		}
+	}
+
+	return nil
+}
+
+//
+// Shards returns the list of known shards
+//
+func (r *StreamReader) Shards() []*ShardDescription {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	shards := make([]*ShardDescription, 0, len(r.shards))
+	for _, shard := range r.shards {
+		shards = append(shards, shard)
+	}
+
+	sort.Sort(shardsBySequence(shards))
+	return shards
+}
+
+//
+// Ready returns the shards that can be read now (the shards not completely read whose parent
+// has been completely read or is not available anymore), ordered by starting sequence number
+//
+func (r *StreamReader) Ready() []*ShardDescription {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ready := []*ShardDescription{}
+
+	for _, shard := range r.shards {
+		if r.completed[shard.ShardId] {
+			continue
+		}
+
+		if parent := shard.ParentShardId; len(parent) > 0 && r.shards[parent] != nil && !r.completed[parent] {
+			continue
+		}
+
+		ready = append(ready, shard)
+	}
+
+	sort.Sort(shardsBySequence(ready))
+	return ready
+}
+
+//
+// ReadShard reads the records currently available in the shard and calls handler for each of them.
+// It returns true if the shard has been completely read.
+//
+// If a checkpoint store is configured the sequence number of the last record of each batch
+// is recorded after the handler has been called for all the records in the batch.
+//
+// An open shard is read until there are no more records, and the next call will continue
+// from where the previous one stopped.
+//
+func (r *StreamReader) ReadShard(shard *ShardDescription, handler RecordHandler) (bool, error) {
+	return r.ReadShardBatches(shard, r.recordBatches(handler))
+}
+
+//
+// recordBatches returns a BatchHandler that calls handler for each record
+//
+func (r *StreamReader) recordBatches(handler RecordHandler) BatchHandler {
+	return func(shardId string, records []Record) error {
+		for _, record := range records {
+			if err := handler(shardId, record); err != nil {
+				return err
+			}
+
+			// on failure restart from the record that failed
+			r.setPosition(shardId, record.Dynamodb.SequenceNumber)
+		}
+
+		return nil
+	}
+}
+
+//
+// ReadShardBatches is like ReadShard, but calls handler with all the records returned by each GetRecords call.
+// If the handler fails the next call will restart from the beginning of the failed batch.
+//
+func (r *StreamReader) ReadShardBatches(shard *ShardDescription, handler BatchHandler) (bool, error) {
+	for {
+		completed, count, err := r.readBatch(shard, handler)
+		if err != nil || completed {
+			return completed, err
+		}
+
+		if count == 0 && shard.IsOpen() {
+			return false, nil
+		}
+	}
+}
+
+//
+// readBatch reads one batch of records (one GetRecords call) from the shard and calls handler with them.
+// It returns true if the shard has been completely read and the number of records read.
+//
+func (r *StreamReader) readBatch(shard *ShardDescription, handler BatchHandler) (completed bool, count int, err error) {
+	if r.isCompleted(shard.ShardId) {
+		return true, 0, nil
+	}
+
+	iterator, ok := r.iterator(shard.ShardId)
+	if !ok {
+		if iterator, completed, err = r.shardIterator(shard); err != nil || completed {
+			return
+		}
+	}
+
+	for len(iterator) > 0 {
+		records, err := r.sc.GetRecords(iterator, r.limit)
+		if isDBError(err, errorExpiredIterator) {
+			// iterators expire after a while: get a new one starting after the last record read
+			if iterator, completed, err = r.shardIterator(shard); err != nil || completed {
+				return completed, 0, err
+			}
+
+			continue
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		if count = len(records.Records); count > 0 {
+			if err := handler(shard.ShardId, records.Records); err != nil {
+				r.setIterator(shard.ShardId, "")
+				return false, 0, err
+			}
+
+			last := records.Records[count-1].Dynamodb.SequenceNumber
+			r.setPosition(shard.ShardId, last)
+
+			if r.checkpoints != nil {
+				if err := r.checkpoints.SetCheckpoint(r.streamArn, shard.ShardId, last); err != nil {
+					return false, count, err
+				}
+			}
+		}
+
+		if iterator = records.NextShardIterator; len(iterator) > 0 {
+			r.setIterator(shard.ShardId, iterator)
+			return false, count, nil
+		}
+
+		break
+	}
+
+	if r.checkpoints != nil && !shard.IsOpen() {
+		if err := r.checkpoints.SetCheckpoint(r.streamArn, shard.ShardId, shard.SequenceNumberRange.EndingSequenceNumber); err != nil {
+			return false, count, err
+		}
+	}
+
+	r.setCompleted(shard.ShardId)
+	return true, count, nil
+}
+
+//
+// shardIterator returns a new iterator for the shard, starting after the last record read
+// (or the last checkpoint) if any. It returns completed=true if the checkpoint shows that
+// the shard has already been completely read.
+//
+func (r *StreamReader) shardIterator(shard *ShardDescription) (iterator string, completed bool, err error) {
+	r.lock.Lock()
+	itype, seq := LAST, ""
+	if r.iteratorType == AT_SEQUENCE || r.iteratorType == AFTER_SEQUENCE {
+		if shard.ShardId == r.sequenceShard {
+			itype, seq = r.iteratorType, r.sequenceNumber
+		}
+	} else if len(shard.ParentShardId) == 0 || r.shards[shard.ParentShardId] == nil {
+		itype = r.iteratorType
+	}
+
+	position := r.positions[shard.ShardId]
+	r.lock.Unlock()
+
+	if len(position) == 0 && r.checkpoints != nil {
+		if position, err = r.checkpoints.GetCheckpoint(r.streamArn, shard.ShardId); err != nil {
+			return
+		}
+	}
+
+	if len(position) > 0 {
+		if !shard.IsOpen() && CompareSequenceNumbers(position, shard.SequenceNumberRange.EndingSequenceNumber) >= 0 {
+			r.setCompleted(shard.ShardId)
+			return "", true, nil
+		}
+
+		itype, seq = AFTER_SEQUENCE, position
+	}
+
+	if iterator, err = r.sc.GetShardIterator(r.streamArn, shard.ShardId, itype, seq); err != nil {
+		return
+	}
+
+	r.setIterator(shard.ShardId, iterator)
+	return
+}
+
+func (r *StreamReader) isCompleted(shardId string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.completed[shardId]
+}
+
+func (r *StreamReader) setCompleted(shardId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.iterators, shardId)
+	r.completed[shardId] = true
+}
+
+func (r *StreamReader) iterator(shardId string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	iterator, ok := r.iterators[shardId]
+	return iterator, ok
+}
+
+//
+// setIterator sets the current iterator for the shard (an empty iterator removes it,
+// so that the next read will get a new one)
+//
+func (r *StreamReader) setIterator(shardId, iterator string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(iterator) == 0 {
+		delete(r.iterators, shardId)
+	} else {
+		r.iterators[shardId] = iterator
+	}
+}
+
+func (r *StreamReader) setPosition(shardId, sequenceNumber string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.positions[shardId] = sequenceNumber
+}
+
+//
+// Disabled returns true if the stream has been disabled (as of the last Refresh)
+//
+func (r *StreamReader) Disabled() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.status == STREAM_STATUS_DISABLED
+}
+
+//
+// Read reads all the records currently available in the stream, parent shards before children.
+// New shards are discovered as the parent shards are completed.
+//
+// The shards that are ready are read in turn, one batch at a time, so that a busy shard doesn't
+// prevent the others from being read.
+//
+func (r *StreamReader) Read(handler RecordHandler) error {
+	_, err := r.read(handler, nil)
+	return err
+}
+
+//
+// read is like Read, but returns the number of records read and stops (before reading the next batch)
+// when the stop channel is closed
+//
+func (r *StreamReader) read(handler RecordHandler, stop <-chan struct{}) (int, error) {
+	count := 0
+
+	batchHandler := r.recordBatches(func(shardId string, record Record) error {
+		count++
+		return handler(shardId, record)
+	})
+
+	for {
+		if err := r.Refresh(); err != nil {
+			return count, err
+		}
+
+		progress := false
+
+		for shards := r.Ready(); len(shards) > 0; {
+			var active []*ShardDescription
+
+			for _, shard := range shards {
+				if isStopped(stop) {
+					return count, nil
+				}
+
+				completed, n, err := r.readBatch(shard, batchHandler)
+				if err != nil {
+					return count, err
+				}
+
+				if completed {
+					progress = true
+				} else if n > 0 || !shard.IsOpen() {
+					active = append(active, shard)
+				}
+			}
+
+			shards = active
+		}
+
+		if !progress {
+			return count, nil
+		}
+	}
+}
+
+//
+// isStopped returns true if the stop channel has been closed (false for a nil channel)
+//
+func isStopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+//
+// Follow reads the records of the stream continuously (like "tail -f"), waiting when no new records
+// are available and discovering new shards as they are created.
+//
+// It returns when the handler returns an error, when the stop channel is closed or when the stream
+// has been disabled and all the shards have been read.
+//
+func (r *StreamReader) Follow(handler RecordHandler, stop <-chan struct{}) error {
+	return r.follow(func() (int, error) {
+		return r.read(handler, stop)
+	}, stop)
+}
+
+//
+// follow calls read until it fails, the stop channel is closed or the stream is disabled and completely read,
+// waiting with exponential backoff when read returns no records
+//
+func (r *StreamReader) follow(read func() (int, error), stop <-chan struct{}) error {
+	wait := r.minWait
+
+	for {
+		count, err := read()
+		if err != nil || isStopped(stop) {
+			return err
+		}
+
+		if r.Disabled() && len(r.Ready()) == 0 {
+			return nil
+		}
+
+		if count > 0 {
+			wait = r.minWait
+		}
+
+		select {
+		case <-stop:
+			return nil
+
+		case <-time.After(wait):
+		}
+
+		if count == 0 && wait < r.maxWait {
+			if wait *= 2; wait > r.maxWait {
+				wait = r.maxWait
+			}
+		}
+	}
+}
+
+//
+// IsOpen returns true if the shard is still receiving records
+//
+func (shard *ShardDescription) IsOpen() bool {
+	return len(shard.SequenceNumberRange.EndingSequenceNumber) == 0
+}
+
+//
+// CompareSequenceNumbers compares two sequence numbers (numeric strings) and
+// returns -1, 0 or 1 if a is less, equal or greater than b
+//
+func CompareSequenceNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type shardsBySequence []*ShardDescription
+
+func (s shardsBySequence) Len() int      { return len(s) }
+func (s shardsBySequence) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s shardsBySequence) Less(i, j int) bool {
+	return CompareSequenceNumbers(s[i].SequenceNumberRange.StartingSequenceNumber,
+		s[j].SequenceNumberRange.StartingSequenceNumber) < 0
+}
@@ -0,0 +1,280 @@
+package dynago
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DEFAULT_SUBSCRIPTION_BUFFER = 100
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// Record filters
+//
+
+//
+// RecordFilter returns true if the record should be delivered to a subscriber
+//
+type RecordFilter func(record Record) bool
+
+//
+// FilterEvent matches records with one of the specified event types
+//
+func FilterEvent(types ...EventType) RecordFilter {
+	return func(record Record) bool {
+		t := ParseEventType(record.EventName)
+
+		for _, et := range types {
+			if t == et {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+//
+// FilterKeyPrefix matches records where the (string) value of the key attribute starts with prefix
+//
+func FilterKeyPrefix(keyName, prefix string) RecordFilter {
+	return func(record Record) bool {
+		s, ok := record.Dynamodb.Keys[keyName].(string)
+		return ok && strings.HasPrefix(s, prefix)
+	}
+}
+
+//
+// FilterChanged matches records where any of the attribute paths (or their children) has been
+// added, removed or changed. MODIFY events only match if the stream has both images (NEW_AND_OLD_IMAGES).
+//
+func FilterChanged(paths ...string) RecordFilter {
+	return func(record Record) bool {
+		diff := NewChangeEvent(record).Diff
+		if diff == nil {
+			return false
+		}
+
+		for _, list := range [][]string{diff.Added, diff.Removed, diff.Changed} {
+			for _, changed := range list {
+				for _, path := range paths {
+					if changed == path || strings.HasPrefix(changed, path+".") || strings.HasPrefix(changed, path+"[") {
+						return true
+					}
+				}
+			}
+		}
+
+		return false
+	}
+}
+
+//
+// FilterExpression matches records where the new image satisfies the expression (see ParseExpression)
+//
+func FilterExpression(expr string, names map[string]string, values map[string]interface{}) (RecordFilter, error) {
+	e, err := ParseExpression(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(record Record) bool {
+		if len(record.Dynamodb.newImage) > 0 {
+			return e.MatchAttributes(record.Dynamodb.newImage)
+		}
+
+		return len(record.Dynamodb.NewImage) > 0 && e.Match(record.Dynamodb.NewImage)
+	}, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+//
+// StreamFanout
+//
+
+//
+// Subscription receives the records that match all its filters on the Records channel.
+// The channel is closed when the subscription is cancelled or the fan-out stops.
+//
+type Subscription struct {
+	Records <-chan Record
+
+	records chan Record
+	filters []RecordFilter
+	drop    bool
+	dropped int64
+	done    chan struct{}
+	fanout  *StreamFanout
+
+	lock   sync.Mutex // held while sending to records
+	closed bool
+}
+
+func (sub *Subscription) match(record Record) bool {
+	for _, filter := range sub.filters {
+		if !filter(record) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//
+// Dropped returns the number of records dropped because the buffer was full
+// (only for subscriptions created with SubscribeDropping)
+//
+func (sub *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&sub.dropped)
+}
+
+//
+// Cancel removes the subscription from the fan-out and closes the Records channel
+//
+func (sub *Subscription) Cancel() {
+	sub.fanout.unsubscribe(sub)
+	sub.close()
+}
+
+func (sub *Subscription) close() {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.records)
+	}
+}
+
+//
+// StreamFanout reads a stream once and dispatches the records to multiple subscribers
+//
+type StreamFanout struct {
+	reader *StreamReader
+
+	lock sync.Mutex
+	subs []*Subscription
+}
+
+func NewStreamFanout(reader *StreamReader) *StreamFanout {
+	return &StreamFanout{reader: reader}
+}
+
+//
+// Subscribe adds a subscriber with a buffer of the specified size.
+// When the buffer is full the fan-out waits for the subscriber to receive the records.
+//
+func (f *StreamFanout) Subscribe(buffer int, filters ...RecordFilter) *Subscription {
+	return f.subscribe(buffer, false, filters)
+}
+
+//
+// SubscribeDropping adds a subscriber with a buffer of the specified size.
+// When the buffer is full the records for this subscriber are dropped.
+//
+func (f *StreamFanout) SubscribeDropping(buffer int, filters ...RecordFilter) *Subscription {
+	return f.subscribe(buffer, true, filters)
+}
+
+func (f *StreamFanout) subscribe(buffer int, drop bool, filters []RecordFilter) *Subscription {
+	if buffer < 0 {
+		buffer = DEFAULT_SUBSCRIPTION_BUFFER
+	}
+
+	records := make(chan Record, buffer)
+
+	sub := &Subscription{
+		Records: records,
+		records: records,
+		filters: filters,
+		drop:    drop,
+		done:    make(chan struct{}),
+		fanout:  f,
+	}
+
+	f.lock.Lock()
+	f.subs = append(f.subs, sub)
+	f.lock.Unlock()
+
+	return sub
+}
+
+func (f *StreamFanout) unsubscribe(sub *Subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, s := range f.subs {
+		if s == sub {
+			f.subs = append(f.subs[:i], f.subs[i+1:]...)
+			close(sub.done)
+			return
+		}
+	}
+}
+
+//
+// Run reads the stream (see StreamReader.Follow) and dispatches the records to the subscribers
+// until the stop channel is closed. All the subscriptions are closed when Run returns.
+//
+func (f *StreamFanout) Run(stop <-chan struct{}) error {
+	defer f.closeAll()
+
+	return f.reader.Follow(func(shardId string, record Record) error {
+		f.lock.Lock()
+		subs := make([]*Subscription, len(f.subs))
+		copy(subs, f.subs)
+		f.lock.Unlock()
+
+		for _, sub := range subs {
+			if sub.match(record) {
+				f.send(sub, record, stop)
+			}
+		}
+
+		return nil
+	}, stop)
+}
+
+func (f *StreamFanout) send(sub *Subscription, record Record, stop <-chan struct{}) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	if sub.drop {
+		select {
+		case sub.records <- record:
+		case <-sub.done:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+
+		return
+	}
+
+	select {
+	case sub.records <- record:
+	case <-sub.done:
+	case <-stop:
+	}
+}
+
+//
+// closeAll cancels all the subscriptions
+//
+func (f *StreamFanout) closeAll() {
+	f.lock.Lock()
+	subs := f.subs
+	f.subs = nil
+	f.lock.Unlock()
+
+	for _, sub := range subs {
+		close(sub.done)
+		sub.close()
+	}
+}
@@ -22,6 +22,13 @@ const (
 
 	STREAM_VIEW_DISABLED = "NO" // this is NOT a real value, it tells the API to disable streams for the table
 
+	PROJECTION_ALL       = "ALL"
+	PROJECTION_KEYS_ONLY = "KEYS_ONLY"
+	PROJECTION_INCLUDE   = "INCLUDE"
+
+	BILLING_MODE_PROVISIONED     = "PROVISIONED"
+	BILLING_MODE_PAY_PER_REQUEST = "PAY_PER_REQUEST"
+
 	errorNotFound = "ResourceNotFoundException"
 )
 
@@ -29,6 +36,8 @@ var (
 	ERR_MISSING_KEY   = errors.New("hash-key required")
 	ERR_TOO_MANY_KEYS = errors.New("too many keys")
 	ERR_NOT_FOUND     = errors.New(errorNotFound)
+	ERR_TIMEOUT       = errors.New("timeout")
+	ERR_INVALID_KEY   = errors.New("missing or invalid key attribute")
 )
 
 // EpochTime is like Time, but unmarshal from a number (seconds since Unix epoch) instead of a formatted string
@@ -50,6 +59,12 @@ func (t *EpochTime) UnmarshalJSON(data []byte) (err error) {
 	return nil
 }
 
+// Marshal from time.Time to number, so that it can be read back
+
+func (t EpochTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Unix())
+}
+
 // Table definition
 
 type AttributeDefinition struct {
@@ -63,7 +78,7 @@ type KeySchemaElement struct {
 }
 
 type ProjectionDescription struct {
-	NonKeyAttributes []string
+	NonKeyAttributes []string `json:",omitempty"`
 	ProjectionType   string
 }
 
@@ -76,6 +91,17 @@ type LocalSecondaryIndexDescription struct {
 	Projection ProjectionDescription
 }
 
+type GlobalSecondaryIndexDescription struct {
+	IndexName      string
+	IndexStatus    string
+	IndexSizeBytes int64
+	ItemCount      int64
+
+	KeySchema             []KeySchemaElement
+	Projection            ProjectionDescription
+	ProvisionedThroughput ProvisionedThroughputDescription
+}
+
 type ProvisionedThroughputDescription struct {
 	LastDecreaseDateTime   EpochTime
 	LastIncreaseDateTime   EpochTime
@@ -84,21 +110,29 @@ type ProvisionedThroughputDescription struct {
 	WriteCapacityUnits     int
 }
 
+type BillingModeSummary struct {
+	BillingMode string
+}
+
 type TableDescription struct {
 	AttributeDefinitions []AttributeDefinition
+	BillingModeSummary   *BillingModeSummary `json:",omitempty"` // nil for provisioned tables created before on-demand billing
 
 	CreationDateTime EpochTime
 	ItemCount        int64
 
-	KeySchema             []KeySchemaElement
-	LocalSecondaryIndexes []LocalSecondaryIndexDescription
-	ProvisionedThroughput ProvisionedThroughputDescription
+	KeySchema              []KeySchemaElement
+	LocalSecondaryIndexes  []LocalSecondaryIndexDescription
+	GlobalSecondaryIndexes []GlobalSecondaryIndexDescription
+	ProvisionedThroughput  ProvisionedThroughputDescription
 
 	TableName      string
 	TableSizeBytes int64
 	TableStatus    string
 
 	StreamSpecification StreamSpecification
+	LatestStreamArn     string
+	LatestStreamLabel   string
 }
 
 type StreamSpecification struct {
@@ -163,13 +197,22 @@ type LocalSecondaryIndexRequest struct {
 	Projection ProjectionDescription
 }
 
-type CreateTableRequest struct {
-	TableName             string
-	ProvisionedThroughput ProvisionedThroughputRequest
-	AttributeDefinitions  []AttributeDefinition
+type GlobalSecondaryIndexRequest struct {
+	IndexName             string
 	KeySchema             []KeySchemaElement
-	LocalSecondaryIndexes []LocalSecondaryIndexRequest
-	StreamSpecification   StreamSpecification
+	Projection            ProjectionDescription
+	ProvisionedThroughput *ProvisionedThroughputRequest `json:",omitempty"` // nil for PAY_PER_REQUEST tables
+}
+
+type CreateTableRequest struct {
+	TableName              string
+	BillingMode            string                        `json:",omitempty"`
+	ProvisionedThroughput  *ProvisionedThroughputRequest `json:",omitempty"` // nil for PAY_PER_REQUEST tables
+	AttributeDefinitions   []AttributeDefinition
+	KeySchema              []KeySchemaElement
+	LocalSecondaryIndexes  []LocalSecondaryIndexRequest  `json:",omitempty"`
+	GlobalSecondaryIndexes []GlobalSecondaryIndexRequest `json:",omitempty"`
+	StreamSpecification    StreamSpecification
 }
 
 type CreateTableResult struct {
@@ -179,7 +222,7 @@ type CreateTableResult struct {
 func (db *DBClient) CreateTable(tableName string, attributes []AttributeDefinition, keys []string, rc, wc int, streamView string) (*TableDescription, error) {
 	createReq := CreateTableRequest{
 		TableName:             tableName,
-		ProvisionedThroughput: ProvisionedThroughputRequest{rc, wc},
+		ProvisionedThroughput: &ProvisionedThroughputRequest{rc, wc},
 	}
 
 	if len(keys) < 1 {
@@ -213,6 +256,98 @@ func (db *DBClient) CreateTable(tableName string, attributes []AttributeDefiniti
 	return &createRes.TableDescription, nil
 }
 
+//
+// CreateTableFromDescription creates a table with the same attributes, keys, secondary indexes,
+// billing mode (and provisioned throughput) and stream specification of an existing table
+//
+func (db *DBClient) CreateTableFromDescription(tableName string, desc *TableDescription) (*TableDescription, error) {
+	createReq := CreateTableRequest{
+		TableName:           tableName,
+		KeySchema:           desc.KeySchema,
+		StreamSpecification: desc.StreamSpecification,
+	}
+
+	provisioned := desc.BillingModeSummary == nil || desc.BillingModeSummary.BillingMode != BILLING_MODE_PAY_PER_REQUEST
+	if provisioned {
+		createReq.ProvisionedThroughput = &ProvisionedThroughputRequest{
+			desc.ProvisionedThroughput.ReadCapacityUnits,
+			desc.ProvisionedThroughput.WriteCapacityUnits,
+		}
+	} else {
+		createReq.BillingMode = BILLING_MODE_PAY_PER_REQUEST
+	}
+
+	// DynamoDB rejects attribute definitions that are not used by any key schema
+	used := map[string]bool{}
+	for _, ks := range desc.KeySchema {
+		used[ks.AttributeName] = true
+	}
+
+	for _, lsi := range desc.LocalSecondaryIndexes {
+		createReq.LocalSecondaryIndexes = append(createReq.LocalSecondaryIndexes,
+			LocalSecondaryIndexRequest{lsi.IndexName, lsi.KeySchema, lsi.Projection})
+
+		for _, ks := range lsi.KeySchema {
+			used[ks.AttributeName] = true
+		}
+	}
+
+	for _, gsi := range desc.GlobalSecondaryIndexes {
+		greq := GlobalSecondaryIndexRequest{IndexName: gsi.IndexName, KeySchema: gsi.KeySchema, Projection: gsi.Projection}
+		if provisioned {
+			greq.ProvisionedThroughput = &ProvisionedThroughputRequest{
+				gsi.ProvisionedThroughput.ReadCapacityUnits,
+				gsi.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+
+		createReq.GlobalSecondaryIndexes = append(createReq.GlobalSecondaryIndexes, greq)
+
+		for _, ks := range gsi.KeySchema {
+			used[ks.AttributeName] = true
+		}
+	}
+
+	for _, attr := range desc.AttributeDefinitions {
+		if used[attr.AttributeName] {
+			createReq.AttributeDefinitions = append(createReq.AttributeDefinitions, attr)
+		}
+	}
+
+	var createRes CreateTableResult
+
+	if err := db.Query("CreateTable", createReq).Decode(&createRes); err != nil {
+		return nil, err
+	}
+
+	return &createRes.TableDescription, nil
+}
+
+//
+// WaitForTable waits until the table is in the specified status (i.e. TABLE_STATUS_ACTIVE)
+// or the timeout expires
+//
+func (db *DBClient) WaitForTable(tableName, status string, timeout time.Duration) (*TableDescription, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		desc, err := db.DescribeTable(tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		if desc.TableStatus == status {
+			return desc, nil
+		}
+
+		if time.Now().After(deadline) {
+			return desc, ERR_TIMEOUT
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
 func (db *DBClient) CreateTableInstance(tableName string, attributes []AttributeDefinition, keys []string, rc, wc int, streamView string) (*TableInstance, error) {
 	desc, err := db.CreateTable(tableName, attributes, keys, rc, wc, streamView)
 	if err != nil {
@@ -303,6 +438,10 @@ type TableInstance struct {
 	DB   *DBClient
 	Name string
 	Keys map[string]*AttributeDefinition
+
+	versionAttr string             // see SetVersionAttribute
+	cache       *ItemCache         // see SetCache
+	indexes     []*IndexDefinition // see QueryIndex
 }
 
 func (db *DBClient) GetTable(tableName string) (*TableInstance, error) {
@@ -322,6 +461,8 @@ func (db *DBClient) GetTable(tableName string) (*TableInstance, error) {
 
 	}
 
+	table.indexes = desc.indexDefinitions()
+
 	return &table, nil
 }
 
@@ -342,7 +483,11 @@ func (table *TableInstance) HashRange() bool {
 	return table.Keys[RANGE_KEY_TYPE] != nil
 }
 
-func (table *TableInstance) GetItem(hashKey interface{}, rangeKey interface{}, attributes []string, consistent bool, consumed bool) (map[string]interface{}, float32, error) {
+func (table *TableInstance) GetItem(hashKey interface{}, rangeKey interface{}, attributes []string, consistent bool, consumed bool, options ...GetItemOption) (map[string]interface{}, ConsumedCapacityDescription, error) {
+	if table.isCacheable(attributes) {
+		return table.cachedGetItem(hashKey, rangeKey, consistent, consumed, options...)
+	}
+
 	hkey := &KeyValue{*table.Keys[HASH_KEY_TYPE], hashKey}
 
 	var rkey *KeyValue
@@ -350,14 +495,56 @@ func (table *TableInstance) GetItem(hashKey interface{}, rangeKey interface{}, a
 		rkey = &KeyValue{*table.Keys[RANGE_KEY_TYPE], rangeKey}
 	}
 
-	return table.DB.GetItem(table.Name, hkey, rkey, attributes, consistent, consumed)
+	return table.DB.GetItem(table.Name, hkey, rkey, attributes, consistent, consumed, options...)
 }
 
-func (table *TableInstance) PutItem(item Item, options ...ItemOption) (*Item, float32, error) {
-	return table.DB.PutItem(table.Name, item, options...)
+//
+// PutItem writes the item. The key attributes are only checked before sending the request
+// if the ValidateKeys option is passed.
+//
+func (table *TableInstance) PutItem(item Item, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
+	hashKey, rangeKey, err := table.keyValues(item)
+	if err != nil && callerOptions(options).validateKeys {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	if table.cache != nil && err == nil {
+		defer table.invalidateItem(hashKey, rangeKey)
+	}
+
+	if len(table.versionAttr) == 0 {
+		return table.DB.PutItem(table.Name, item, options...)
+	}
+
+	current := item[table.versionAttr]
+
+	next, err := nextVersion(current)
+	if err != nil {
+		return nil, ConsumedCapacityDescription{}, err
+	}
+
+	vitem := Item{}
+	for k, v := range item {
+		vitem[k] = v
+	}
+
+	versionChecked := len(callerOptions(options).ConditionExpression) == 0
+	options = append(options, table.putVersionOption(current, next))
+
+	res, consumed, err := table.DB.PutItem(table.Name, vitem, options...)
+	if err != nil {
+		return nil, consumed, table.versionError(err, versionChecked, current)
+	}
+
+	item[table.versionAttr] = next
+	return res, consumed, nil
 }
 
-func (table *TableInstance) UpdateItem(hashKey interface{}, rangeKey interface{}, updates string, options ...ItemOption) (*Item, float32, error) {
+func (table *TableInstance) UpdateItem(hashKey interface{}, rangeKey interface{}, updates string, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
+	if table.cache != nil {
+		defer table.invalidateItem(hashKey, rangeKey)
+	}
+
 	hkey := &KeyValue{*table.Keys[HASH_KEY_TYPE], hashKey}
 
 	var rkey *KeyValue
@@ -365,10 +552,28 @@ func (table *TableInstance) UpdateItem(hashKey interface{}, rangeKey interface{}
 		rkey = &KeyValue{*table.Keys[RANGE_KEY_TYPE], rangeKey}
 	}
 
-	return table.DB.UpdateItem(table.Name, hkey, rkey, updates, options...)
+	if len(table.versionAttr) == 0 {
+		return table.DB.UpdateItem(table.Name, hkey, rkey, updates, options...)
+	}
+
+	caller := callerOptions(options)
+	expected := caller.expectedVersion
+	versionChecked := expected != nil && len(caller.ConditionExpression) == 0
+	options = append(options, table.updateVersionOption())
+
+	res, consumed, err := table.DB.UpdateItem(table.Name, hkey, rkey, updates, options...)
+	if err != nil {
+		return nil, consumed, table.versionError(err, versionChecked, expected)
+	}
+
+	return res, consumed, nil
 }
 
-func (table *TableInstance) DeleteItem(hashKey interface{}, rangeKey interface{}, options ...ItemOption) (*Item, float32, error) {
+func (table *TableInstance) DeleteItem(hashKey interface{}, rangeKey interface{}, options ...ItemOption) (*Item, ConsumedCapacityDescription, error) {
+	if table.cache != nil {
+		defer table.invalidateItem(hashKey, rangeKey)
+	}
+
 	hkey := &KeyValue{*table.Keys[HASH_KEY_TYPE], hashKey}
 
 	var rkey *KeyValue
@@ -376,7 +581,21 @@ func (table *TableInstance) DeleteItem(hashKey interface{}, rangeKey interface{}
 		rkey = &KeyValue{*table.Keys[RANGE_KEY_TYPE], rangeKey}
 	}
 
-	return table.DB.DeleteItem(table.Name, hkey, rkey, options...)
+	if len(table.versionAttr) == 0 {
+		return table.DB.DeleteItem(table.Name, hkey, rkey, options...)
+	}
+
+	caller := callerOptions(options)
+	expected := caller.expectedVersion
+	versionChecked := expected != nil && len(caller.ConditionExpression) == 0
+	options = append(options, table.deleteVersionOption())
+
+	res, consumed, err := table.DB.DeleteItem(table.Name, hkey, rkey, options...)
+	if err != nil {
+		return nil, consumed, table.versionError(err, versionChecked, expected)
+	}
+
+	return res, consumed, nil
 }
 
 func (table *TableInstance) Query(hashKey interface{}) *QueryRequest {
@@ -0,0 +1,202 @@
+package dynago
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	errorConditionalCheckFailed = "ConditionalCheckFailedException"
+
+	versionName  = "#dynagoVersion"
+	versionValue = ":dynagoVersion"
+	versionNext  = ":dynagoNextVersion"
+)
+
+var (
+	addClause = regexp.MustCompile(`(?i)(^|\s)ADD\s`)
+)
+
+//
+// ErrVersionConflict is returned by versioned tables when the item version
+// doesn't match the expected one (because the item was modified by someone else).
+//
+// If the caller passed its own ConditionExpression the original ConditionalCheckFailedException
+// is returned instead, since DynamoDB doesn't tell which part of the condition failed.
+//
+type ErrVersionConflict struct {
+	TableName string
+	Attribute string
+	Expected  interface{} // nil if the item was expected not to exist
+}
+
+func (err *ErrVersionConflict) Error() string {
+	if err.Expected == nil {
+		return fmt.Sprintf("version conflict on %v: item already exists", err.TableName)
+	}
+
+	return fmt.Sprintf("version conflict on %v: expected %v=%v", err.TableName, err.Attribute, err.Expected)
+}
+
+//
+// SetVersionAttribute enables optimistic locking for the table, using the named (numeric) attribute as version
+// (an empty name disables it).
+//
+// With versioning enabled:
+//
+// - PutItem writes the item only if the stored version matches the version in the item (or, if the item
+// has no version, only if the item doesn't exist yet) and increments the version in the item
+//
+// - UpdateItem always increments the version, and checks it if the ExpectedVersion option is passed
+//
+// - DeleteItem checks the version if the ExpectedVersion option is passed
+//
+// If the check fails the methods return an *ErrVersionConflict
+//
+func (table *TableInstance) SetVersionAttribute(name string) *TableInstance {
+	table.versionAttr = name
+	return table
+}
+
+func (table *TableInstance) VersionAttribute() string {
+	return table.versionAttr
+}
+
+//
+// ExpectedVersion sets the version the item should have for UpdateItem and DeleteItem on versioned tables
+//
+func ExpectedVersion(version interface{}) ItemOption {
+	return func(req *ItemRequest) {
+		req.expectedVersion = version
+	}
+}
+
+//
+// nextVersion returns the version following the current one (1 if the current version is nil)
+//
+func nextVersion(current interface{}) (int64, error) {
+	if current == nil {
+		return 1, nil
+	}
+
+	n, ok := toNumber(current)
+	if !ok {
+		return 0, fmt.Errorf("invalid version %v", current)
+	}
+
+	return int64(n) + 1, nil
+}
+
+func (req *ItemRequest) addCondition(cond string) {
+	if len(req.ConditionExpression) > 0 {
+		req.ConditionExpression = "(" + req.ConditionExpression + ") AND " + cond
+	} else {
+		req.ConditionExpression = cond
+	}
+}
+
+func (req *ItemRequest) addName(name, value string) {
+	names := map[string]string{name: value}
+	for k, v := range req.ExpressionAttributeNames {
+		names[k] = v
+	}
+
+	req.ExpressionAttributeNames = names
+}
+
+func (req *ItemRequest) addValue(name string, value interface{}) {
+	values := AttributeNameValue{name: EncodeValue(value)}
+	for k, v := range req.ExpressionAttributeValues {
+		values[k] = v
+	}
+
+	req.ExpressionAttributeValues = values
+}
+
+//
+// addUpdateAction adds an action to the ADD clause of the update expression, creating the clause if needed
+// (i.e. addUpdateAction("SET a = :a", "b :b") returns "SET a = :a ADD b :b")
+//
+func addUpdateAction(updates, action string) string {
+	if loc := addClause.FindStringIndex(updates); loc != nil {
+		return updates[:loc[1]] + action + ", " + updates[loc[1]:]
+	}
+
+	if len(updates) == 0 {
+		return "ADD " + action
+	}
+
+	return updates + " ADD " + action
+}
+
+//
+// putVersionOption checks and increments the version for PutItem.
+// It should be the last option, so that it can merge with the caller conditions.
+//
+func (table *TableInstance) putVersionOption(current interface{}, next int64) ItemOption {
+	return func(req *ItemRequest) {
+		req.addName(versionName, table.versionAttr)
+
+		if current == nil {
+			req.addCondition("attribute_not_exists(" + versionName + ")")
+		} else {
+			req.addValue(versionValue, current)
+			req.addCondition(versionName + " = " + versionValue)
+		}
+
+		(*req.Item)[table.versionAttr] = next
+	}
+}
+
+//
+// updateVersionOption increments the version for UpdateItem (and checks it if ExpectedVersion was set)
+//
+func (table *TableInstance) updateVersionOption() ItemOption {
+	return func(req *ItemRequest) {
+		req.addName(versionName, table.versionAttr)
+		req.addValue(versionNext, 1)
+		req.UpdateExpression = addUpdateAction(req.UpdateExpression, versionName+" "+versionNext)
+
+		if req.expectedVersion != nil {
+			req.addValue(versionValue, req.expectedVersion)
+			req.addCondition(versionName + " = " + versionValue)
+		}
+	}
+}
+
+//
+// deleteVersionOption checks the version for DeleteItem if ExpectedVersion was set
+//
+func (table *TableInstance) deleteVersionOption() ItemOption {
+	return func(req *ItemRequest) {
+		if req.expectedVersion != nil {
+			req.addName(versionName, table.versionAttr)
+			req.addValue(versionValue, req.expectedVersion)
+			req.addCondition(versionName + " = " + versionValue)
+		}
+	}
+}
+
+//
+// versionError converts a failed condition into ErrVersionConflict, if the version check was
+// the only condition of the request (versionChecked)
+//
+func (table *TableInstance) versionError(err error, versionChecked bool, expected interface{}) error {
+	if versionChecked && isDBError(err, errorConditionalCheckFailed) {
+		return &ErrVersionConflict{TableName: table.Name, Attribute: table.versionAttr, Expected: expected}
+	}
+
+	return err
+}
+
+//
+// callerOptions applies the caller options to an empty request, to inspect them
+//
+func callerOptions(options []ItemOption) *ItemRequest {
+	req := &ItemRequest{Item: &Item{}}
+	for _, option := range options {
+		option(req)
+	}
+
+	return req
+}